@@ -1,10 +1,11 @@
 module github.com/bipinshashi/log-collection
 
-go 1.21
+go 1.22
 
 require (
 	github.com/gorilla/mux v1.8.1
 	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/klauspost/compress v1.18.0
 )
 
 require github.com/a-h/templ v0.2.778
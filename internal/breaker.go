@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errCircuitOpen = errors.New("skipped after repeated failures")
+
+// CircuitBreaker keeps track of peers that keep failing and skips them for a
+// cool-down period instead of waiting on them for every request. Once the
+// period is over a single request is let through, and the peer is used
+// again if it succeeds. A nil CircuitBreaker never skips a peer.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu    sync.Mutex
+	peers map[string]*circuit
+}
+
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	// a request has been let through after the cool-down
+	probing bool
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, peers: map[string]*circuit{}}
+}
+
+// allow reports whether peer may be queried at now.
+func (b *CircuitBreaker) allow(peer string, now time.Time) bool {
+	if b == nil || b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.peers[peer]
+	if c == nil || c.failures < b.threshold {
+		return true
+	}
+	if now.Before(c.openUntil) {
+		return false
+	}
+	// let this request through and keep the others out until it reports back
+	c.openUntil = now.Add(b.cooldown)
+	c.probing = true
+	return true
+}
+
+// abandon notes that a request to peer ended without telling how the peer
+// is doing. If it was let through after the cool-down, the next request is
+// let through instead of waiting for another cool-down.
+func (b *CircuitBreaker) abandon(peer string, now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.peers[peer]; c != nil && c.probing {
+		c.openUntil, c.probing = now, false
+	}
+}
+
+// forget drops the state of peers that are no longer among peers, such as
+// discovered peers that went away.
+func (b *CircuitBreaker) forget(peers []string) {
+	if b == nil {
+		return
+	}
+	current := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		current[peer] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for peer := range b.peers {
+		if !current[peer] {
+			delete(b.peers, peer)
+		}
+	}
+}
+
+// record notes how a request to peer went.
+func (b *CircuitBreaker) record(peer string, err error, now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.peers, peer)
+		return
+	}
+	c := b.peers[peer]
+	if c == nil {
+		c = &circuit{}
+		b.peers[peer] = c
+	}
+	c.failures++
+	c.probing = false
+	if c.failures >= b.threshold {
+		c.openUntil = now.Add(b.cooldown)
+	}
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 13, 0, 0, 0, time.UTC)
+	failure := errors.New("connection refused")
+	breaker := NewCircuitBreaker(2, time.Minute)
+
+	breaker.record("api-2", failure, start)
+	if !breaker.allow("api-2", start) {
+		t.Fatal("allow() after one failure = false, want true")
+	}
+	breaker.record("api-2", failure, start)
+	if breaker.allow("api-2", start.Add(30*time.Second)) {
+		t.Fatal("allow() during cool-down = true, want false")
+	}
+	if !breaker.allow("api-3", start) {
+		t.Fatal("allow() for another peer = false, want true")
+	}
+
+	// after the cool-down a single request is let through
+	probe := start.Add(time.Minute)
+	if !breaker.allow("api-2", probe) {
+		t.Fatal("allow() after cool-down = false, want true")
+	}
+	if breaker.allow("api-2", probe) {
+		t.Fatal("allow() while probing = true, want false")
+	}
+	breaker.record("api-2", nil, probe)
+	if !breaker.allow("api-2", probe) {
+		t.Fatal("allow() after a success = false, want true")
+	}
+
+	var disabled *CircuitBreaker
+	if !disabled.allow("api-2", start) {
+		t.Fatal("allow() on a nil breaker = false, want true")
+	}
+}
+
+func TestCircuitBreaker_abandon(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 13, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(1, time.Minute)
+	breaker.record("api-2", errors.New("connection refused"), start)
+
+	// a request that fails before the cool-down is over is no probe
+	breaker.abandon("api-2", start)
+	if breaker.allow("api-2", start) {
+		t.Fatal("allow() during cool-down after abandon() = true, want false")
+	}
+
+	probe := start.Add(time.Minute)
+	if !breaker.allow("api-2", probe) {
+		t.Fatal("allow() after cool-down = false, want true")
+	}
+	breaker.abandon("api-2", probe.Add(time.Second))
+	if !breaker.allow("api-2", probe.Add(time.Second)) {
+		t.Fatal("allow() after an abandoned probe = false, want true")
+	}
+}
+
+func TestCircuitBreaker_forget(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 13, 0, 0, 0, time.UTC)
+	breaker := NewCircuitBreaker(1, time.Minute)
+	breaker.record("api-2", errors.New("connection refused"), start)
+	breaker.record("10.0.0.7:4000", errors.New("connection refused"), start)
+
+	breaker.forget([]string{"api-2", "api-3"})
+	if _, ok := breaker.peers["10.0.0.7:4000"]; ok || len(breaker.peers) != 1 {
+		t.Errorf("forget() kept %v, want only api-2", breaker.peers)
+	}
+	if breaker.allow("api-2", start) {
+		t.Error("allow() for a peer still discovered = true, want false")
+	}
+}
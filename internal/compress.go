@@ -0,0 +1,225 @@
+package internal
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// acceptEncoding is sent to peers, which answer with the encoding they
+// prefer.
+const acceptEncoding = "zstd, gzip"
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	zstdWriters = sync.Pool{New: func() any {
+		encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return encoder
+	}}
+)
+
+// CompressResponses compresses responses of at least minSize bytes with
+// gzip or zstd when the client accepts them. Smaller responses are not
+// worth the overhead, and neither are event streams, which are sent as
+// they happen.
+func CompressResponses(next http.Handler, minSize int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || minSize < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding returns the encoding with the highest weight in an
+// Accept-Encoding header, zstd when both are weighted the same, or "" for
+// none.
+func negotiateEncoding(header string) string {
+	best, bestWeight := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "zstd" {
+			continue
+		}
+		weight := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if weight, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if weight > bestWeight || (weight == bestWeight && weight > 0 && name == "zstd") {
+			best, bestWeight = name, weight
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// the response is large enough to compress.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	started bool
+	encoder io.WriteCloser
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.started {
+		c.ResponseWriter.WriteHeader(status)
+		return
+	}
+	c.status = status
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.started {
+		c.buf = append(c.buf, p...)
+		if len(c.buf) < c.minSize {
+			return len(p), nil
+		}
+		if err := c.start(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if c.encoder != nil {
+		return c.encoder.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush sends what has been written so far, uncompressed if the response
+// has not been started yet.
+func (c *compressWriter) Flush() {
+	if !c.started {
+		c.start(false)
+	}
+	if flusher, ok := c.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// start writes the header and the buffered start of the response.
+func (c *compressWriter) start(compress bool) error {
+	c.started = true
+	header := c.Header()
+	if header.Get("Content-Encoding") != "" || strings.HasPrefix(header.Get("Content-Type"), "text/event-stream") {
+		compress = false
+	}
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if compress {
+		header.Set("Content-Encoding", c.encoding)
+		header.Del("Content-Length")
+		switch c.encoding {
+		case "zstd":
+			encoder := zstdWriters.Get().(*zstd.Encoder)
+			encoder.Reset(c.ResponseWriter)
+			c.encoder = encoder
+		default:
+			encoder := gzipWriters.Get().(*gzip.Writer)
+			encoder.Reset(c.ResponseWriter)
+			c.encoder = encoder
+		}
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	buf := c.buf
+	c.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if c.encoder != nil {
+		_, err := c.encoder.Write(buf)
+		return err
+	}
+	_, err := c.ResponseWriter.Write(buf)
+	return err
+}
+
+// close ends the response, sending it uncompressed if it stayed small.
+func (c *compressWriter) close() {
+	if !c.started {
+		if c.status == 0 && len(c.buf) == 0 {
+			// nothing was written, let the server answer as it would
+			return
+		}
+		c.start(false)
+	}
+	if c.encoder == nil {
+		return
+	}
+	c.encoder.Close()
+	switch encoder := c.encoder.(type) {
+	case *zstd.Encoder:
+		encoder.Reset(nil)
+		zstdWriters.Put(encoder)
+	case *gzip.Writer:
+		encoder.Reset(nil)
+		gzipWriters.Put(encoder)
+	}
+}
+
+// decompressBody replaces the body of a response with its decoded content,
+// for responses to requests that set Accept-Encoding themselves.
+func decompressBody(resp *http.Response) error {
+	var decoded io.ReadCloser
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "":
+		return nil
+	case "gzip":
+		reader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return err
+		}
+		decoded = reader
+	case "zstd":
+		reader, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		decoded = reader.IOReadCloser()
+	default:
+		return nil
+	}
+	resp.Body = &decodedBody{ReadCloser: decoded, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody closes the decoder along with the body it reads from.
+type decodedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (d *decodedBody) Close() error {
+	d.ReadCloser.Close()
+	return d.body.Close()
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_negotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: ""},
+		{header: "gzip", want: "gzip"},
+		{header: "gzip, deflate, br, zstd", want: "zstd"},
+		{header: "zstd;q=0.5, gzip", want: "gzip"},
+		{header: "GZIP;q=0.8", want: "gzip"},
+		{header: "gzip;q=0, br", want: ""},
+		{header: "identity", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_CompressResponses(t *testing.T) {
+	large := strings.Repeat(`{"server":"api-2","message":"payment failed"}`+"\n", 100)
+	small := `{"server":"api-2"}`
+
+	tests := []struct {
+		name         string
+		encoding     string
+		contentType  string
+		body         string
+		flush        bool
+		wantEncoding string
+	}{
+		{name: "gzip", encoding: "gzip", body: large, wantEncoding: "gzip"},
+		{name: "zstd", encoding: "zstd, gzip", body: large, wantEncoding: "zstd"},
+		{name: "Below the threshold", encoding: "gzip", body: small, wantEncoding: ""},
+		{name: "Not accepted", encoding: "", body: large, wantEncoding: ""},
+		{name: "Event stream", encoding: "gzip", contentType: "text/event-stream", body: large, flush: true, wantEncoding: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(CompressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if tt.flush {
+					w.WriteHeader(http.StatusOK)
+					w.(http.Flusher).Flush()
+				}
+				// written in pieces, like the encoders do
+				for _, line := range strings.SplitAfter(tt.body, "\n") {
+					io.WriteString(w, line)
+				}
+			}), 1024))
+			defer server.Close()
+
+			req, _ := http.NewRequest("GET", server.URL, nil)
+			if tt.encoding != "" {
+				req.Header.Set("Accept-Encoding", tt.encoding)
+			}
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if got := resp.Header.Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if err := decompressBody(resp); err != nil {
+				t.Fatalf("decompressBody() error = %v", err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("reading the body: %v", err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func Test_fanOut_compressed(t *testing.T) {
+	page := strings.Repeat(`{"timestamp":"2024-10-01T13:08:11Z","server":"api-2","message":"payment failed"}`+"\n", 50)
+	var encoding string
+	peer := httptest.NewServer(CompressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Type", ndjsonContentType)
+		io.WriteString(w, page)
+	}), 1024))
+	defer peer.Close()
+
+	a := &AppHandler{Client: peer.Client()}
+	stream := a.fanOut(context.Background(), []string{strings.TrimPrefix(peer.URL, "http://")}, RequestParams{lines: 50}, peerOptions{workers: 1, timeout: 5 * time.Second})[0]
+	logs, err := drain(stream)
+	if err != nil || len(logs) != 50 {
+		t.Errorf("fanOut() = %d entries, %v, want 50", len(logs), err)
+	}
+	if encoding != acceptEncoding {
+		t.Errorf("Accept-Encoding = %q, want %q", encoding, acceptEncoding)
+	}
+}
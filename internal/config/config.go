@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
@@ -11,6 +15,65 @@ type Config struct {
 	Port        string `envconfig:"PORT" default:"8080"`
 	Peers       string `envconfig:"PEERS"`
 	WorkerCount int    `envconfig:"WORKER_COUNT" default:"3"`
+	// TimeZone is the zone timestamps without one are written in.
+	TimeZone string `envconfig:"TIMEZONE" default:"Local"`
+	// FileTimeZones overrides TimeZone per file, e.g. "wifi.log=UTC,app.log=Europe/Berlin".
+	FileTimeZones string `envconfig:"FILE_TIMEZONES"`
+	// ParserRules maps file globs to parsers, e.g. "app-*.log=json".
+	ParserRules string `envconfig:"PARSER_RULES"`
+	// JSON*Keys override the keys the json parser reads, e.g. "ts,time".
+	JSONTimestampKeys []string `envconfig:"JSON_TIMESTAMP_KEYS"`
+	JSONLevelKeys     []string `envconfig:"JSON_LEVEL_KEYS"`
+	JSONMessageKeys   []string `envconfig:"JSON_MESSAGE_KEYS"`
+	// PeerTimeout bounds each request to a peer, PeerTimeouts overrides it
+	// per peer, e.g. "api-2:4000=5s,api-3:4000=500ms".
+	PeerTimeout  time.Duration `envconfig:"PEER_TIMEOUT" default:"3s"`
+	PeerTimeouts string        `envconfig:"PEER_TIMEOUTS"`
+	// PeerRetries is how often a failed peer request is retried, waiting a
+	// random part of PeerRetryBackoff, doubled after every attempt.
+	PeerRetries      int           `envconfig:"PEER_RETRIES" default:"2"`
+	PeerRetryBackoff time.Duration `envconfig:"PEER_RETRY_BACKOFF" default:"100ms"`
+	// A peer failing BreakerThreshold requests in a row is skipped for
+	// BreakerCooldown.
+	BreakerThreshold int           `envconfig:"PEER_BREAKER_THRESHOLD" default:"3"`
+	BreakerCooldown  time.Duration `envconfig:"PEER_BREAKER_COOLDOWN" default:"30s"`
+	// PeersFile lists more peers, it is read again when it changes.
+	PeersFile string `envconfig:"PEERS_FILE"`
+	// PeersDNS lists names to look peers up with, SRV names like
+	// "_logs._tcp.example.com" or "host:port" for A records, looked up
+	// again every PeersDNSRefresh.
+	PeersDNS        string        `envconfig:"PEERS_DNS"`
+	PeersDNSRefresh time.Duration `envconfig:"PEERS_DNS_REFRESH" default:"30s"`
+	// PeerRegistration turns on the register endpoint, which requires
+	// RegistrationToken as bearer token. Registered peers are dropped when
+	// they do not register again within RegistrationTTL.
+	PeerRegistration  bool          `envconfig:"PEER_REGISTRATION"`
+	RegistrationTTL   time.Duration `envconfig:"PEER_REGISTRATION_TTL" default:"30s"`
+	RegistrationToken string        `envconfig:"PEER_REGISTRATION_TOKEN"`
+	// RegisterWith is the address of a server to register with as a peer,
+	// under AdvertiseAddr.
+	RegisterWith  string `envconfig:"REGISTER_WITH"`
+	AdvertiseAddr string `envconfig:"ADVERTISE_ADDR"`
+	// MaxFanOutDepth is how many levels of peers below the server a client
+	// asked are queried.
+	MaxFanOutDepth int `envconfig:"MAX_FANOUT_DEPTH" default:"3"`
+	// CompressMinSize is the size from which responses are compressed,
+	// negative to turn compression off.
+	CompressMinSize int `envconfig:"COMPRESS_MIN_SIZE" default:"1024"`
+	// A request stops reading once it has scanned QueryMaxBytes of log
+	// files, holds QueryMaxEntries entries or QueryMaxMemory bytes of them
+	// or has taken QueryMaxTime, and returns what it has. Zero turns a
+	// limit off.
+	QueryMaxBytes   int64         `envconfig:"QUERY_MAX_BYTES" default:"1073741824"`
+	QueryMaxEntries int           `envconfig:"QUERY_MAX_ENTRIES" default:"100000"`
+	QueryMaxMemory  int64         `envconfig:"QUERY_MAX_MEMORY" default:"268435456"`
+	QueryMaxTime    time.Duration `envconfig:"QUERY_MAX_TIME" default:"5s"`
+	// MaxConcurrentScans bounds how many requests read log files at once,
+	// zero for no bound.
+	MaxConcurrentScans int `envconfig:"MAX_CONCURRENT_SCANS" default:"4"`
+	// IndexDir is where the time indexes of log files are kept between
+	// restarts, empty to keep them in memory only.
+	IndexDir string `envconfig:"INDEX_DIR" default:"/tmp/log-collection-index"`
 }
 
 var cfg *Config
@@ -23,3 +86,41 @@ func GetConfig() *Config {
 	})
 	return cfg
 }
+
+// Location returns the time zone entries of fileName are written in.
+func (c *Config) Location(fileName string) (*time.Location, error) {
+	name := c.TimeZone
+	for _, pair := range strings.Split(c.FileTimeZones, ",") {
+		file, zone, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && (file == fileName || file == filepath.Base(fileName)) {
+			name = zone
+			break
+		}
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone for %s: %w", fileName, err)
+	}
+	return location, nil
+}
+
+// PeerTimeoutOverrides parses PeerTimeouts into timeouts by peer.
+func (c *Config) PeerTimeoutOverrides() (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, pair := range strings.Split(c.PeerTimeouts, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		peer, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid peer timeout %q, want peer=duration", pair)
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout for peer %s: %q", peer, value)
+		}
+		timeouts[peer] = timeout
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfig_Location(t *testing.T) {
+	config := &Config{
+		TimeZone:      "UTC",
+		FileTimeZones: "wifi.log=America/New_York, app/app.log=Asia/Tokyo,broken.log=Nowhere/Special",
+	}
+	tests := []struct {
+		name     string
+		fileName string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Default zone",
+			fileName: "system.log",
+			want:     "UTC",
+			wantErr:  false,
+		},
+		{
+			name:     "File override",
+			fileName: "wifi.log",
+			want:     "America/New_York",
+			wantErr:  false,
+		},
+		{
+			name:     "File override with directory",
+			fileName: "app/app.log",
+			want:     "Asia/Tokyo",
+			wantErr:  false,
+		},
+		{
+			name:     "Unknown zone",
+			fileName: "broken.log",
+			want:     "",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.Location(tt.fileName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Location() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("Location() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_PeerTimeoutOverrides(t *testing.T) {
+	tests := []struct {
+		name         string
+		peerTimeouts string
+		want         map[string]time.Duration
+		wantErr      bool
+	}{
+		{
+			name:         "No overrides",
+			peerTimeouts: "",
+			want:         map[string]time.Duration{},
+			wantErr:      false,
+		},
+		{
+			name:         "Overrides",
+			peerTimeouts: "api-2:4000=5s, api-3:4000=500ms",
+			want:         map[string]time.Duration{"api-2:4000": 5 * time.Second, "api-3:4000": 500 * time.Millisecond},
+			wantErr:      false,
+		},
+		{
+			name:         "Invalid duration",
+			peerTimeouts: "api-2:4000=fast",
+			want:         nil,
+			wantErr:      true,
+		},
+		{
+			name:         "Missing duration",
+			peerTimeouts: "api-2:4000",
+			want:         nil,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{PeerTimeouts: tt.peerTimeouts}
+			got, err := config.PeerTimeoutOverrides()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PeerTimeoutOverrides() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PeerTimeoutOverrides() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
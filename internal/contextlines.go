@@ -0,0 +1,202 @@
+package internal
+
+import (
+	"sort"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// contextCollector picks the matching records out of a file read backwards
+// and attaches the records around each match, like grep -B and -A. Records
+// are passed to add newest first.
+type contextCollector struct {
+	params  RequestParams
+	matches []types.LogEntry
+	// the records read last, which follow the next match in the file,
+	// closest last
+	recent []types.LogEntry
+	// indexes of matches still collecting the records before them
+	open []int
+	// entries held in matches, context included, and their size
+	count int
+	size  int
+}
+
+func newContextCollector(params RequestParams) *contextCollector {
+	return &contextCollector{params: params}
+}
+
+// addAll adds records given in file order.
+func (c *contextCollector) addAll(records []types.LogEntry) {
+	for i := len(records) - 1; i >= 0; i-- {
+		c.add(records[i])
+	}
+}
+
+func (c *contextCollector) add(record types.LogEntry) {
+	open := c.open[:0]
+	for _, i := range c.open {
+		c.matches[i].Before = append(c.matches[i].Before, record)
+		c.count++
+		c.size += entrySize(record)
+		if len(c.matches[i].Before) < c.params.before {
+			open = append(open, i)
+		}
+	}
+	c.open = open
+
+	if len(c.matches) < c.params.lines && matchesFilter(record, c.params) {
+		match := record
+		if len(c.recent) > 0 {
+			match.After = reversedEntries(c.recent)
+		}
+		c.matches = append(c.matches, match)
+		c.count += 1 + len(match.After)
+		c.size += entrySize(match)
+		if c.params.before > 0 {
+			c.open = append(c.open, len(c.matches)-1)
+		}
+	}
+
+	if c.params.after > 0 {
+		c.recent = append(c.recent, record)
+		if len(c.recent) > c.params.after {
+			c.recent = c.recent[1:]
+		}
+	}
+}
+
+// full reports whether n matches have been found and all of them have their
+// context.
+func (c *contextCollector) full() bool {
+	return len(c.matches) >= c.params.lines && !c.collecting()
+}
+
+// collecting reports whether a match is still waiting for records before it.
+func (c *contextCollector) collecting() bool {
+	return len(c.open) > 0
+}
+
+// held returns how many entries the collector holds and their size.
+func (c *contextCollector) held() (int, int) {
+	return c.count + len(c.recent), c.size + entriesSize(c.recent)
+}
+
+// result returns the matches newest first.
+func (c *contextCollector) result() []types.LogEntry {
+	for i := range c.matches {
+		if len(c.matches[i].Before) > 0 {
+			c.matches[i].Before = reversedEntries(c.matches[i].Before)
+		}
+	}
+	return c.matches
+}
+
+// newestMatches keeps the n newest matching records of a file read front to
+// back, with the records around each, like grep -B and -A. Only the
+// records needed for context and up to twice n matches are held at a
+// time, however long the file.
+type newestMatches struct {
+	params  RequestParams
+	matches []*match
+	// the records read last, which come before the next match, oldest first
+	recent []types.LogEntry
+	// matches still collecting the records after them
+	open []*match
+	seq  int
+	// entries held in matches, context included, and their size
+	count int
+	size  int
+}
+
+type match struct {
+	entry types.LogEntry
+	// position in the file, newer records with the same time come first
+	seq int
+}
+
+func newNewestMatches(params RequestParams) *newestMatches {
+	return &newestMatches{params: params}
+}
+
+func (m *newestMatches) add(record types.LogEntry) {
+	open := m.open[:0]
+	for _, match := range m.open {
+		match.entry.After = append(match.entry.After, record)
+		m.count++
+		m.size += entrySize(record)
+		if len(match.entry.After) < m.params.after {
+			open = append(open, match)
+		}
+	}
+	m.open = open
+
+	if matchesFilter(record, m.params) {
+		found := &match{entry: record, seq: m.seq}
+		if len(m.recent) > 0 {
+			found.entry.Before = append([]types.LogEntry(nil), m.recent...)
+		}
+		m.matches = append(m.matches, found)
+		m.count += 1 + len(found.entry.Before)
+		m.size += entrySize(found.entry)
+		if m.params.after > 0 {
+			m.open = append(m.open, found)
+		}
+		if len(m.matches) >= 2*m.params.lines {
+			m.keepNewest()
+		}
+	}
+
+	if m.params.before > 0 {
+		m.recent = append(m.recent, record)
+		if len(m.recent) > m.params.before {
+			m.recent = m.recent[1:]
+		}
+	}
+	m.seq++
+}
+
+// keepNewest drops all but the n newest matches. Matches dropped while
+// still collecting context are simply not returned.
+func (m *newestMatches) keepNewest() {
+	sort.Slice(m.matches, func(i, j int) bool {
+		a, b := m.matches[i], m.matches[j]
+		if a.entry.Timestamp.Equal(b.entry.Timestamp) {
+			return a.seq > b.seq
+		}
+		return a.entry.Timestamp.After(b.entry.Timestamp)
+	})
+	if len(m.matches) > m.params.lines {
+		clear(m.matches[m.params.lines:])
+		m.matches = m.matches[:m.params.lines]
+	}
+	m.count, m.size = 0, 0
+	for _, match := range m.matches {
+		m.count += 1 + len(match.entry.Before) + len(match.entry.After)
+		m.size += entrySize(match.entry)
+	}
+}
+
+// held returns how many entries are held and their size. Matches dropped
+// while still collecting context are counted until the next clean up.
+func (m *newestMatches) held() (int, int) {
+	return m.count + len(m.recent), m.size + entriesSize(m.recent)
+}
+
+// result returns the n newest matches, newest first.
+func (m *newestMatches) result() []types.LogEntry {
+	m.keepNewest()
+	var logs []types.LogEntry
+	for _, match := range m.matches {
+		logs = append(logs, match.entry)
+	}
+	return logs
+}
+
+func reversedEntries(entries []types.LogEntry) []types.LogEntry {
+	out := make([]types.LogEntry, len(entries))
+	for i, entry := range entries {
+		out[len(entries)-1-i] = entry
+	}
+	return out
+}
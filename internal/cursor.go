@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor marks where a page of results ended so that the next request
+// continues with the entries before it. Servers holds, for every server
+// that has returned entries, the position and time of the oldest one,
+// keyed by cursorKey. Servers that have not returned any entries yet, or
+// have restarted since, only return entries up to
+// Until, the time of the oldest entry on the page, so entries appended
+// since the first page do not show up on later ones.
+type pageCursor struct {
+	Servers map[string]cursorPosition `json:"servers,omitempty"`
+	Until   time.Time                 `json:"until"`
+}
+
+type cursorPosition struct {
+	File      string    `json:"file"`
+	FileID    string    `json:"file_id,omitempty"`
+	Offset    int64     `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// parseCursor decodes a cursor returned by encode.
+func parseCursor(value string) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// encode returns the cursor in the opaque form handed to clients.
+func (c *pageCursor) encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		// a cursor only holds strings, numbers and times
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorKey keys the position of a server in a cursor. Servers may share
+// a name, so the instance that read the entries is part of the key.
+func cursorKey(server, instance string) string {
+	if instance == "" {
+		return server
+	}
+	return server + "/" + instance
+}
+
+// position returns where reading should continue for server.
+func (c *pageCursor) position(server, instance string) (cursorPosition, bool) {
+	if c == nil {
+		return cursorPosition{}, false
+	}
+	position, ok := c.Servers[cursorKey(server, instance)]
+	return position, ok
+}
+
+// nextCursor returns the cursor for the page after logs, which are sorted
+// newest first and continue from prev, or nil if logs holds the last
+// entries there are. A page cut short by the query limits is not the last,
+// unless it holds no entries to continue after.
+func nextCursor(prev *pageCursor, logs []types.LogEntry, lines int, truncated bool) *pageCursor {
+	if len(logs) < lines && (!truncated || len(logs) == 0) {
+		return nil
+	}
+	next := &pageCursor{Servers: map[string]cursorPosition{}}
+	if prev != nil {
+		for server, position := range prev.Servers {
+			next.Servers[server] = position
+		}
+		next.Until = prev.Until
+	}
+	for _, entry := range logs {
+		if entry.Position == nil {
+			continue
+		}
+		next.Servers[cursorKey(entry.Server, entry.Position.Instance)] = cursorPosition{
+			File:      entry.Position.File,
+			FileID:    entry.Position.FileID,
+			Offset:    entry.Position.Offset,
+			Timestamp: entry.Timestamp,
+		}
+		if !entry.Timestamp.IsZero() {
+			next.Until = entry.Timestamp
+		}
+	}
+	return next
+}
+
+// resumeFrom works out where in files, the log file followed by its rotated
+// generations newest first, reading continues for a cursor position. It
+// returns the index of the file to start with and how many bytes of it to
+// read. The file is found by its identity, wherever rotation has moved it,
+// and entries that share the position's time are told apart by their
+// offset. Once the file is gone reading starts over from the top, keeping
+// only entries older than the position.
+func resumeFrom(files []string, position cursorPosition, params RequestParams) (int, int64, RequestParams) {
+	if position.FileID != "" {
+		for i, file := range files {
+			if hasIdentity(file, position.FileID) {
+				return i, position.Offset, params
+			}
+		}
+	}
+	if !position.Timestamp.IsZero() {
+		params.until = earliest(params.until, position.Timestamp.Add(-time.Nanosecond))
+	}
+	return 0, -1, params
+}
+
+// fileIdentity identifies a file by a hash of its first fingerprintSize
+// bytes, or all of them in a smaller file, along with how many bytes were
+// hashed. Rotation renames files but keeps their start, and a new file
+// starts with different lines.
+func fileIdentity(file io.ReaderAt, size int64) (string, error) {
+	length := min(size, fingerprintSize)
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, 0, length)); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%x", length, hash.Sum(nil)[:8]), nil
+}
+
+// hasIdentity reports whether the file at path has the identity id and
+// still holds the bytes it had then.
+func hasIdentity(path, id string) bool {
+	length, _, ok := strings.Cut(id, "-")
+	if !ok {
+		return false
+	}
+	size, err := strconv.ParseInt(length, 10, 64)
+	if err != nil {
+		return false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.Size() < size {
+		return false
+	}
+	got, err := fileIdentity(file, size)
+	return err == nil && got == id
+}
+
+// earliest returns the earlier of two bounds, either of which may be zero
+// for no bound.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+func Test_pageCursor_walk(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "system.log")
+	var gz bytes.Buffer
+	gzWriter := gzip.NewWriter(&gz)
+	gzWriter.Write([]byte("Oct 1 13:08:01 entry 1\nOct 1 13:08:02 entry 2\n"))
+	gzWriter.Close()
+	if err := os.WriteFile(path+".1.gz", gz.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("Oct 1 13:08:03 entry 3\nOct 1 13:08:04 entry 4\nOct 1 13:08:05 entry 5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := logSource{server: "api", location: time.UTC}
+	params := RequestParams{fileName: "system.log", lines: 2}
+	var got []string
+	for page := 0; page < 5; page++ {
+		logs, err := readLastNLinesRotated(path, params, source)
+		if err != nil {
+			t.Fatalf("readLastNLinesRotated() error = %v", err)
+		}
+		for _, entry := range logs {
+			got = append(got, entry.Message)
+		}
+
+		// entries written between pages must not show up on later pages
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.WriteString("Oct 1 13:09:00 appended\n")
+		file.Close()
+
+		next := nextCursor(params.cursor, logs, params.lines, params.budget.truncated() != "")
+		if next == nil {
+			break
+		}
+		// cursors are handed to clients and back in their encoded form
+		params.cursor, err = parseCursor(next.encode())
+		if err != nil {
+			t.Fatalf("parseCursor() error = %v", err)
+		}
+	}
+
+	want := []string{"entry 5", "entry 4", "entry 3", "entry 2", "entry 1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pages = %q, want %q", got, want)
+	}
+}
+
+func Test_nextCursor(t *testing.T) {
+	at := func(sec int) time.Time {
+		return time.Date(2024, time.October, 1, 13, 8, sec, 0, time.UTC)
+	}
+	logs := []types.LogEntry{
+		{Timestamp: at(9), Server: "api", Position: &types.Position{File: "system.log", Offset: 40}},
+		{Timestamp: at(8), Server: "api-2", Position: &types.Position{File: "system.log", Offset: 90}},
+		{Timestamp: at(7), Server: "api", Position: &types.Position{File: "system.log", Offset: 20}},
+	}
+	prev := &pageCursor{
+		Servers: map[string]cursorPosition{"api-3": {File: "system.log.1", Offset: 5, Timestamp: at(1)}},
+		Until:   at(10),
+	}
+
+	got := nextCursor(prev, logs, 3, false)
+	want := &pageCursor{
+		Servers: map[string]cursorPosition{
+			"api":   {File: "system.log", Offset: 20, Timestamp: at(7)},
+			"api-2": {File: "system.log", Offset: 90, Timestamp: at(8)},
+			"api-3": {File: "system.log.1", Offset: 5, Timestamp: at(1)},
+		},
+		Until: at(7),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("nextCursor() = %+v, want %+v", got, want)
+	}
+	if got := nextCursor(prev, logs, 4, false); got != nil {
+		t.Errorf("nextCursor() for a short page = %+v, want nil", got)
+	}
+	if got := nextCursor(prev, logs, 4, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("nextCursor() for a truncated page = %+v, want %+v", got, want)
+	}
+	if got := nextCursor(prev, nil, 4, true); got != nil {
+		t.Errorf("nextCursor() for an empty truncated page = %+v, want nil", got)
+	}
+
+	// servers sharing a name keep their own positions
+	shared := []types.LogEntry{
+		{Timestamp: at(9), Server: "api", Position: &types.Position{File: "system.log", Offset: 40, Instance: "a"}},
+		{Timestamp: at(8), Server: "api", Position: &types.Position{File: "system.log", Offset: 90, Instance: "b"}},
+	}
+	got = nextCursor(nil, shared, 2, false)
+	for instance, offset := range map[string]int64{"a": 40, "b": 90} {
+		if position, ok := got.position("api", instance); !ok || position.Offset != offset {
+			t.Errorf("position(api, %s) = %+v, %v, want offset %d", instance, position, ok, offset)
+		}
+	}
+	if _, ok := got.position("api", "c"); ok {
+		t.Errorf("position(api, c) found, want none for a restarted server")
+	}
+}
+
+func Test_resumeFrom(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "system.log")
+	rotated := []byte("Oct 1 13:08:03 entry 3\n")
+	current := []byte("Oct 1 13:08:04 entry 4\nOct 1 13:08:05 entry 5\nOct 1 13:08:06 entry 6\n")
+	if err := os.WriteFile(path+".1", rotated, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, current, 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{path, path + ".1"}
+	timestamp := time.Date(2024, time.October, 1, 13, 8, 3, 0, time.UTC)
+	identity := func(content []byte) string {
+		id, err := fileIdentity(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	tests := []struct {
+		name      string
+		position  cursorPosition
+		wantStart int
+		wantLimit int64
+		wantUntil time.Time
+	}{
+		{
+			name:      "Position in the current file",
+			position:  cursorPosition{File: "system.log", FileID: identity(current), Offset: 10, Timestamp: timestamp},
+			wantStart: 0,
+			wantLimit: 10,
+		},
+		{
+			name:      "Position in a file that grew since",
+			position:  cursorPosition{File: "system.log", FileID: identity(current[:23]), Offset: 10, Timestamp: timestamp},
+			wantStart: 0,
+			wantLimit: 10,
+		},
+		{
+			name:      "File renamed by rotation",
+			position:  cursorPosition{File: "system.log", FileID: identity(rotated), Offset: 10, Timestamp: timestamp},
+			wantStart: 1,
+			wantLimit: 10,
+		},
+		{
+			name:      "New file grown past the offset",
+			position:  cursorPosition{File: "system.log", FileID: identity([]byte("Oct 1 13:08:01 entry 1\n")), Offset: 10, Timestamp: timestamp},
+			wantStart: 0,
+			wantLimit: -1,
+			wantUntil: timestamp.Add(-time.Nanosecond),
+		},
+		{
+			name:      "File truncated since",
+			position:  cursorPosition{File: "system.log", FileID: identity(append(current, current...)), Offset: 100, Timestamp: timestamp},
+			wantStart: 0,
+			wantLimit: -1,
+			wantUntil: timestamp.Add(-time.Nanosecond),
+		},
+		{
+			name:      "Position without identity",
+			position:  cursorPosition{File: "system.log", Offset: 10, Timestamp: timestamp},
+			wantStart: 0,
+			wantLimit: -1,
+			wantUntil: timestamp.Add(-time.Nanosecond),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, limit, params := resumeFrom(files, tt.position, RequestParams{})
+			if start != tt.wantStart || limit != tt.wantLimit || !params.until.Equal(tt.wantUntil) {
+				t.Errorf("resumeFrom() = %v, %v, until %v, want %v, %v, until %v", start, limit, params.until, tt.wantStart, tt.wantLimit, tt.wantUntil)
+			}
+		})
+	}
+}
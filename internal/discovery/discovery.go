@@ -0,0 +1,65 @@
+// Package discovery finds the peers a server collects logs from. Peers can
+// be listed in the configuration, in a file that is re-read when it
+// changes, looked up in DNS or register themselves over HTTP.
+package discovery
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// Source provides the current set of peers as host:port addresses.
+type Source interface {
+	Peers(ctx context.Context) ([]string, error)
+}
+
+// Static is a fixed list of peers.
+type Static []string
+
+// ParseStatic parses a comma separated list of peers, as in PEERS.
+func ParseStatic(list string) Static {
+	return Static(splitList(list))
+}
+
+func (s Static) Peers(ctx context.Context) ([]string, error) {
+	return s, nil
+}
+
+// Multi combines sources. A failing source is logged and the others are
+// still used, along with any peers it returned anyway, such as the last
+// answer of a name that no longer resolves.
+type Multi []Source
+
+func (m Multi) Peers(ctx context.Context) ([]string, error) {
+	var peers []string
+	seen := map[string]bool{}
+	for _, source := range m {
+		found, err := source.Peers(ctx)
+		if err != nil {
+			log.Printf("peer discovery: %v", err)
+		}
+		for _, peer := range found {
+			if !seen[peer] {
+				seen[peer] = true
+				peers = append(peers, peer)
+			}
+		}
+	}
+	return peers, nil
+}
+
+// splitList splits a list separated by commas or new lines, dropping blank
+// entries and # comments.
+func splitList(list string) []string {
+	var items []string
+	for _, line := range strings.Split(list, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, item := range strings.Split(line, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
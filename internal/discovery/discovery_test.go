@@ -0,0 +1,29 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type failingSource struct{}
+
+func (failingSource) Peers(ctx context.Context) ([]string, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestMulti_Peers(t *testing.T) {
+	sources := Multi{
+		ParseStatic("api-2:4000, api-3:4000"),
+		failingSource{},
+		Static{"api-3:4000", "api-4:4000"},
+	}
+	got, err := sources.Peers(context.Background())
+	if err != nil {
+		t.Fatalf("Peers() error = %v", err)
+	}
+	if want := []string{"api-2:4000", "api-3:4000", "api-4:4000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() = %v, want %v", got, want)
+	}
+}
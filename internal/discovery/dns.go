@@ -0,0 +1,115 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolver is the part of *net.Resolver DNS discovery uses, so tests can
+// stub it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNS looks peers up in DNS. Names starting with an underscore, such as
+// "_logs._tcp.example.com", are looked up as SRV records and give the
+// target and port of every record. Other names are "host:port" and give
+// every address of host with that port. Answers are cached for refresh,
+// and a name that fails to resolve keeps its last answer.
+type DNS struct {
+	names    []string
+	resolver Resolver
+	refresh  time.Duration
+	now      func() time.Time
+
+	mu         sync.Mutex
+	expires    time.Time
+	refreshing bool
+	answers    map[string][]string
+	peers      []string
+}
+
+// NewDNS returns a source for the comma separated names, as in PEERS_DNS.
+// A nil resolver uses net.DefaultResolver.
+func NewDNS(names string, resolver Resolver, refresh time.Duration) *DNS {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &DNS{names: splitList(names), resolver: resolver, refresh: refresh, now: time.Now}
+}
+
+// Peers returns the peers every name resolves to. Names are looked up
+// without holding the lock, and while one request refreshes them the others
+// get the last answer. It returns the peers it has along with the errors of
+// the names that failed.
+func (d *DNS) Peers(ctx context.Context) ([]string, error) {
+	d.mu.Lock()
+	if d.peers != nil && (d.refreshing || d.now().Before(d.expires)) {
+		defer d.mu.Unlock()
+		return d.peers, nil
+	}
+	d.refreshing = true
+	d.mu.Unlock()
+
+	found := make([][]string, len(d.names))
+	errs := make([]error, len(d.names))
+	for i, name := range d.names {
+		found[i], errs[i] = d.lookup(ctx, name)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.answers == nil {
+		d.answers = map[string][]string{}
+	}
+	peers := []string{}
+	var failed []error
+	for i, name := range d.names {
+		// keep the last answer rather than lose the name's peers to a
+		// resolver hiccup
+		if errs[i] != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", name, errs[i]))
+		} else {
+			d.answers[name] = found[i]
+		}
+		peers = append(peers, d.answers[name]...)
+	}
+	d.peers, d.expires, d.refreshing = peers, d.now().Add(d.refresh), false
+	return peers, errors.Join(failed...)
+}
+
+func (d *DNS) lookup(ctx context.Context, name string) ([]string, error) {
+	if strings.HasPrefix(name, "_") {
+		_, records, err := d.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		var peers []string
+		for _, record := range records {
+			target := strings.TrimSuffix(record.Target, ".")
+			peers = append(peers, net.JoinHostPort(target, strconv.Itoa(int(record.Port))))
+		}
+		return peers, nil
+	}
+
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS peer %q, want host:port or an SRV name", name)
+	}
+	addresses, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var peers []string
+	for _, address := range addresses {
+		peers = append(peers, net.JoinHostPort(address, port))
+	}
+	return peers, nil
+}
@@ -0,0 +1,157 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type stubResolver struct {
+	hosts   map[string][]string
+	srv     map[string][]*net.SRV
+	lookups int
+	err     error
+}
+
+func (r *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	addresses, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addresses, nil
+}
+
+func (r *stubResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.lookups++
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	records, ok := r.srv[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return name, records, nil
+}
+
+func TestDNS_Peers(t *testing.T) {
+	resolver := &stubResolver{
+		hosts: map[string][]string{"logs.internal": {"10.0.0.2", "10.0.0.3"}},
+		srv: map[string][]*net.SRV{"_logs._tcp.example.com": {
+			{Target: "api-4.example.com.", Port: 4000},
+			{Target: "api-5.example.com.", Port: 4001},
+		}},
+	}
+	now := time.Date(2024, time.October, 1, 13, 0, 0, 0, time.UTC)
+	dns := NewDNS("logs.internal:4000, _logs._tcp.example.com", resolver, time.Minute)
+	dns.now = func() time.Time { return now }
+
+	want := []string{"10.0.0.2:4000", "10.0.0.3:4000", "api-4.example.com:4000", "api-5.example.com:4001"}
+	got, err := dns.Peers(context.Background())
+	if err != nil {
+		t.Fatalf("Peers() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() = %v, want %v", got, want)
+	}
+
+	// answers are cached until the refresh interval is over
+	dns.Peers(context.Background())
+	if resolver.lookups != 2 {
+		t.Errorf("resolver got %d lookups, want 2", resolver.lookups)
+	}
+
+	// a failing lookup keeps the last answer
+	now = now.Add(2 * time.Minute)
+	resolver.err = errors.New("server misbehaving")
+	got, err = dns.Peers(context.Background())
+	if err == nil {
+		t.Errorf("Peers() with a failing resolver error = nil, want an error")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() with a failing resolver = %v, want %v", got, want)
+	}
+}
+
+func TestDNS_Peers_failingName(t *testing.T) {
+	resolver := &stubResolver{hosts: map[string][]string{"logs.internal": {"10.0.0.2"}}}
+	now := time.Date(2024, time.October, 1, 13, 0, 0, 0, time.UTC)
+	dns := NewDNS("logs.internal:4000, new.internal:4000", resolver, time.Minute)
+	dns.now = func() time.Time { return now }
+
+	// a name that does not resolve yet leaves the others
+	got, err := dns.Peers(context.Background())
+	if err == nil {
+		t.Errorf("Peers() with a failing name error = nil, want an error")
+	}
+	if want := []string{"10.0.0.2:4000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() with a failing name = %v, want %v", got, want)
+	}
+
+	// each name keeps its own last answer
+	now = now.Add(2 * time.Minute)
+	resolver.hosts = map[string][]string{"new.internal": {"10.0.0.9"}}
+	got, err = dns.Peers(context.Background())
+	if err == nil {
+		t.Errorf("Peers() with a failing name error = nil, want an error")
+	}
+	if want := []string{"10.0.0.2:4000", "10.0.0.9:4000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() with a failing name = %v, want %v", got, want)
+	}
+}
+
+func TestDNS_Peers_invalidName(t *testing.T) {
+	dns := NewDNS("logs.internal", &stubResolver{}, time.Minute)
+	if _, err := dns.Peers(context.Background()); err == nil {
+		t.Errorf("Peers() for a name without port error = nil, want an error")
+	}
+}
+
+// blockingResolver holds lookups until release is closed.
+type blockingResolver struct {
+	stubResolver
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.started <- struct{}{}
+	<-r.release
+	return r.stubResolver.LookupHost(ctx, host)
+}
+
+func TestDNS_Peers_slowResolver(t *testing.T) {
+	resolver := &blockingResolver{
+		stubResolver: stubResolver{hosts: map[string][]string{"logs.internal": {"10.0.0.2"}}},
+		started:      make(chan struct{}, 1),
+		release:      make(chan struct{}),
+	}
+	dns := NewDNS("logs.internal:4000", resolver, 0)
+	close(resolver.release)
+	if _, err := dns.Peers(context.Background()); err != nil {
+		t.Fatalf("Peers() error = %v", err)
+	}
+	<-resolver.started
+
+	// the next refresh hangs, and requests in the meantime get the last
+	// answer
+	resolver.release = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		dns.Peers(context.Background())
+		close(done)
+	}()
+	<-resolver.started
+	got, err := dns.Peers(context.Background())
+	if want := []string{"10.0.0.2:4000"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() during a refresh = %v, %v, want %v", got, err, want)
+	}
+	close(resolver.release)
+	<-done
+}
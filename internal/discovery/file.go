@@ -0,0 +1,47 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// File reads peers from a file, one per line or separated by commas. The
+// file is read again whenever its modification time or size changes, so
+// peers can be added without restarting the server.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	peers   []string
+}
+
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) Peers(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if f.peers != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.peers, nil
+	}
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	f.peers = splitList(string(data))
+	if f.peers == nil {
+		f.peers = []string{}
+	}
+	return f.peers, nil
+}
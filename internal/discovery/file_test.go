@@ -0,0 +1,48 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFile_Peers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers")
+	write := func(data string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// the modification time may not change within a test otherwise
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Date(2024, time.October, 1, 13, 0, 0, 0, time.UTC)
+	file := NewFile(path)
+
+	write("# secondaries\napi-2:4000\napi-3:4000, api-4:4000\n\n", start)
+	got, err := file.Peers(context.Background())
+	if err != nil {
+		t.Fatalf("Peers() error = %v", err)
+	}
+	if want := []string{"api-2:4000", "api-3:4000", "api-4:4000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() = %v, want %v", got, want)
+	}
+
+	write("api-5:4000\n", start.Add(time.Second))
+	got, err = file.Peers(context.Background())
+	if err != nil {
+		t.Fatalf("Peers() after change error = %v", err)
+	}
+	if want := []string{"api-5:4000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() after change = %v, want %v", got, want)
+	}
+
+	os.Remove(path)
+	if _, err := file.Peers(context.Background()); err == nil {
+		t.Errorf("Peers() for a missing file error = nil, want an error")
+	}
+}
@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registration is the body of a request to the register endpoint.
+type Registration struct {
+	Address string `json:"address"`
+}
+
+// Registry holds peers that registered themselves. A peer has to register
+// again within ttl, otherwise it is dropped.
+type Registry struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	peers map[string]time.Time // address to expiry
+}
+
+func NewRegistry(ttl time.Duration) *Registry {
+	return &Registry{ttl: ttl, now: time.Now, peers: map[string]time.Time{}}
+}
+
+// Register adds or renews a peer.
+func (r *Registry) Register(address string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peers[address] = r.now().Add(r.ttl)
+}
+
+// Peers returns the peers whose registration has not expired, sorted.
+func (r *Registry) Peers(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	peers := []string{}
+	for address, expires := range r.peers {
+		if now.After(expires) {
+			delete(r.peers, address)
+			continue
+		}
+		peers = append(peers, address)
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
+
+// Heartbeat registers address with the server at primary every interval
+// until ctx is done. token is sent as bearer token if not empty.
+func Heartbeat(ctx context.Context, client *http.Client, primary, address, token string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := register(ctx, client, primary, address, token); err != nil && ctx.Err() == nil {
+			log.Printf("registering with %s: %v", primary, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func register(ctx context.Context, client *http.Client, primary, address, token string) error {
+	body, err := json.Marshal(Registration{Address: address})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", "http://"+primary+"/api/v1/peers/register", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Peers(t *testing.T) {
+	now := time.Date(2024, time.October, 1, 13, 0, 0, 0, time.UTC)
+	registry := NewRegistry(30 * time.Second)
+	registry.now = func() time.Time { return now }
+
+	registry.Register("api-3:4000")
+	registry.Register("api-2:4000")
+	now = now.Add(20 * time.Second)
+	registry.Register("api-2:4000")
+
+	got, _ := registry.Peers(context.Background())
+	if want := []string{"api-2:4000", "api-3:4000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() = %v, want %v", got, want)
+	}
+
+	// api-3 stopped sending heartbeats
+	now = now.Add(20 * time.Second)
+	got, _ = registry.Peers(context.Background())
+	if want := []string{"api-2:4000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Peers() after expiry = %v, want %v", got, want)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	registrations := make(chan Registration, 10)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/peers/register" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var registration Registration
+		json.NewDecoder(r.Body).Decode(&registration)
+		registrations <- registration
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer primary.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Heartbeat(ctx, primary.Client(), primary.Listener.Addr().String(), "api-2:4000", "secret", 10*time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case registration := <-registrations:
+			if registration.Address != "api-2:4000" {
+				t.Errorf("registration = %+v, want api-2:4000", registration)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no heartbeat received")
+		}
+	}
+}
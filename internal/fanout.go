@@ -0,0 +1,434 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/config"
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+const (
+	// peerFanOutTimeout bounds, from when a request comes in, the local scan
+	// and the wait for peers, leaving part of the server's WriteTimeout to
+	// merge and write the response
+	peerFanOutTimeout = 10 * time.Second
+	// maxErrorBodySize is how much of an error response is kept
+	maxErrorBodySize = 512
+	// ndjsonContentType is used for responses with one entry per line
+	ndjsonContentType = "application/x-ndjson"
+	// entryCountHeader carries the number of entries of a /api/v1/logs page
+	entryCountHeader = "X-Entry-Count"
+)
+
+var (
+	errInvalidPeerResponse = errors.New("invalid response")
+	errPeerPending         = errors.New("no answer within max_wait")
+)
+
+// peerStatusError is returned for responses other than 200 OK.
+type peerStatusError struct {
+	status  string
+	code    int
+	message string
+}
+
+func (e *peerStatusError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("unexpected status %s: %s", e.status, e.message)
+	}
+	return fmt.Sprintf("unexpected status %s", e.status)
+}
+
+// peerStream delivers the entries of a peer newest first while they arrive,
+// so they can be merged without holding every peer's page in memory. Only
+// the merge reads from it.
+type peerStream struct {
+	peer    string
+	entries chan types.LogEntry
+	start   time.Time
+	ctx     context.Context
+	// closed once the budget for answering is spent
+	budget <-chan struct{}
+
+	mu sync.Mutex
+	// set by the request once it is done with the peer
+	err      error
+	attempts int
+	// latency is how long the peer took to answer, zero until it has
+	latency time.Duration
+	// limit is the limit that stopped the peer reading, if any
+	limit string
+	// returned is how many entries the peer returned, whether or not the
+	// merge took them
+	returned int
+
+	// set by the merge
+	count    int
+	finished bool
+	gaveUp   error
+}
+
+// next returns the peer's next entry. It gives up on peers that have not
+// answered at all within the budget, and on all of them once ctx is done.
+func (s *peerStream) next() (types.LogEntry, bool) {
+	if s.finished || s.gaveUp != nil {
+		return types.LogEntry{}, false
+	}
+	budget := s.budget
+	if s.count > 0 {
+		// peers that answered in time are read to the end
+		budget = nil
+	}
+	// entries that have arrived are taken even when the budget is spent
+	select {
+	case entry, ok := <-s.entries:
+		return s.received(entry, ok)
+	default:
+	}
+	select {
+	case entry, ok := <-s.entries:
+		return s.received(entry, ok)
+	case <-budget:
+		s.gaveUp = errPeerPending
+	case <-s.ctx.Done():
+		s.gaveUp = s.ctx.Err()
+	}
+	return types.LogEntry{}, false
+}
+
+func (s *peerStream) received(entry types.LogEntry, ok bool) (types.LogEntry, bool) {
+	if !ok {
+		s.finished = true
+		return types.LogEntry{}, false
+	}
+	s.count++
+	return entry, true
+}
+
+// result returns how the peer answered. A peer that was still sending
+// entries when the merge had enough of them is fine.
+func (s *peerStream) result() (attempts int, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.gaveUp != nil:
+		err = s.gaveUp
+	case s.finished:
+		err = s.err
+	}
+	latency = s.latency
+	if latency == 0 {
+		latency = time.Since(s.start)
+	}
+	return s.attempts, latency, err
+}
+
+func (s *peerStream) stoppedAt(limit string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+}
+
+// sent records how many entries the peer returned.
+func (s *peerStream) sent(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.returned = n
+}
+
+// entryCount returns how many entries the peer returned. The merge may
+// take fewer of them. Peers that do not say how many are counted as their
+// entries are read.
+func (s *peerStream) entryCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.returned
+}
+
+// truncated returns the limit that stopped the peer reading, if any.
+func (s *peerStream) truncated() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limit
+}
+
+func (s *peerStream) answered(attempts int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = attempts
+	s.err = err
+	if s.latency == 0 {
+		s.latency = time.Since(s.start)
+	}
+}
+
+// peerOptions controls how peers are queried.
+type peerOptions struct {
+	workers int
+	// timeouts bounds each attempt per peer, timeout is used for the others
+	timeout  time.Duration
+	timeouts map[string]time.Duration
+	retries  int
+	backoff  time.Duration
+	// maxWait is how long to wait for peers before returning without the
+	// slow ones, zero to wait for all of them
+	maxWait time.Duration
+	// trace is passed on to peers in the trace header
+	trace []string
+}
+
+func (o peerOptions) timeoutFor(peer string) time.Duration {
+	if timeout, ok := o.timeouts[peer]; ok {
+		return timeout
+	}
+	return o.timeout
+}
+
+// peerOptionsFromConfig reads the peer options from the configuration.
+func peerOptionsFromConfig(c *config.Config) (peerOptions, error) {
+	timeouts, err := c.PeerTimeoutOverrides()
+	if err != nil {
+		return peerOptions{}, err
+	}
+	return peerOptions{
+		workers:  c.WorkerCount,
+		timeout:  c.PeerTimeout,
+		timeouts: timeouts,
+		retries:  c.PeerRetries,
+		backoff:  c.PeerRetryBackoff,
+	}, nil
+}
+
+// fanOut requests a page of entries from every peer, at most
+// options.workers at a time, and returns exactly one stream per peer in the
+// order of peers. The streams stop when ctx is done, reporting the
+// context's error for peers that had not finished. Peers the circuit
+// breaker holds back report errCircuitOpen. With options.maxWait set,
+// peers that have not answered within it report errPeerPending.
+func (a *AppHandler) fanOut(ctx context.Context, peers []string, params RequestParams, options peerOptions) []*peerStream {
+	start := time.Now()
+	workers := options.workers
+	if workers < 1 {
+		workers = 1
+	}
+	// a nil channel never fires, so without a budget every peer is waited for
+	var budget chan struct{}
+	if options.maxWait > 0 {
+		budget = make(chan struct{})
+		timer := time.AfterFunc(options.maxWait, func() { close(budget) })
+		context.AfterFunc(ctx, func() { timer.Stop() })
+	}
+
+	slots := make(chan struct{}, workers)
+	streams := make([]*peerStream, len(peers))
+	for i, peer := range peers {
+		stream := &peerStream{peer: peer, entries: make(chan types.LogEntry, peerStreamBuffer), start: start, ctx: ctx, budget: budget}
+		streams[i] = stream
+		go func() {
+			defer close(stream.entries)
+			// a slot is held until the peer answers, not while its entries
+			// are merged, as the merge needs the first entry of every peer
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				stream.answered(0, ctx.Err())
+				return
+			}
+			// only asked once the peer is about to be queried, as the
+			// breaker may let this be the one request after its cool-down
+			if !a.Breaker.allow(peer, time.Now()) {
+				<-slots
+				stream.answered(0, errCircuitOpen)
+				return
+			}
+			resp, attempts, err := a.openPeer(ctx, getUrlForPeer(peer, params), options.timeoutFor(peer), options)
+			<-slots
+			if err == nil {
+				stream.stoppedAt(resp.Header.Get(truncatedHeader))
+				// the peer says how many entries its page has, as the merge
+				// may stop reading it before the end
+				announced, countErr := strconv.Atoi(resp.Header.Get(entryCountHeader))
+				if countErr == nil {
+					stream.sent(announced)
+				}
+				decoded := 0
+				err = decodePeerLogs(resp, func(entry types.LogEntry) bool {
+					if decoded++; countErr != nil {
+						stream.sent(decoded)
+					}
+					select {
+					case stream.entries <- entry:
+						return true
+					case <-ctx.Done():
+						return false
+					}
+				})
+				resp.Body.Close()
+			}
+			if err != nil {
+				log.Printf("peer %s: %v", peer, err)
+			}
+			// giving up on the whole request says nothing about the peer, and
+			// a peer refusing a loop is working fine
+			switch {
+			case ctx.Err() != nil:
+				a.Breaker.abandon(peer, time.Now())
+			case errors.Is(err, errRequestLoop):
+				a.Breaker.record(peer, nil, time.Now())
+			default:
+				a.Breaker.record(peer, err, time.Now())
+			}
+			stream.answered(attempts, err)
+		}()
+	}
+	return streams
+}
+
+// openPeer requests a page of entries from a peer, retrying failures that
+// may be temporary with a jittered, exponential backoff. Log queries have
+// no side effects, so retrying them is safe. It returns the response,
+// whose body has to be closed, and the number of attempts made.
+func (a *AppHandler) openPeer(ctx context.Context, url string, timeout time.Duration, options peerOptions) (*http.Response, int, error) {
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, timeout)
+		resp, err := a.requestPeerLogs(attemptCtx, url, options.trace)
+		if err == nil {
+			// the timeout covers reading the entries as well
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, attempt, nil
+		}
+		cancel()
+		if attempt > options.retries || !retryable(ctx, err) {
+			return nil, attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, attempt, ctx.Err()
+		case <-time.After(jitter(options.backoff << (attempt - 1))):
+		}
+	}
+}
+
+// cancelOnClose releases the context of a request along with its body.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// retryable reports whether a failed peer request is worth repeating:
+// connection errors, timeouts of the attempt and server errors are, client
+// errors and invalid responses are not.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, errRequestLoop) {
+		return false
+	}
+	var statusErr *peerStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= http.StatusInternalServerError || statusErr.code == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, errInvalidPeerResponse)
+}
+
+// jitter returns a random duration up to d, so peers that failed together
+// are not retried in lockstep.
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d) + 1
+}
+
+// requestPeerLogs requests a page of entries from a peer, as NDJSON so
+// they can be read while they arrive.
+func (a *AppHandler) requestPeerLogs(ctx context.Context, url string, trace []string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ndjsonContentType)
+	// large pages compress well, with the server name and keys repeated on
+	// every line
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	setTrace(req, trace)
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := decompressBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %v", errInvalidPeerResponse, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		if resp.StatusCode == http.StatusLoopDetected {
+			return nil, loopError(resp, trace, strings.TrimSpace(string(body)))
+		}
+		return nil, &peerStatusError{status: resp.Status, code: resp.StatusCode, message: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
+
+// decodePeerLogs calls emit for every entry of a peer's response until emit
+// returns false. Peers that do not stream answer with a JSON array.
+func decodePeerLogs(resp *http.Response, emit func(types.LogEntry) bool) error {
+	decoder := json.NewDecoder(resp.Body)
+	// keep numbers in Fields exactly as the peer sent them
+	decoder.UseNumber()
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), ndjsonContentType) {
+		var logs []types.LogEntry
+		if err := decoder.Decode(&logs); err != nil {
+			return invalidPeerResponse(err)
+		}
+		for _, entry := range logs {
+			if !emit(entry) {
+				return nil
+			}
+		}
+		return nil
+	}
+	for {
+		var entry types.LogEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return invalidPeerResponse(err)
+		}
+		if !emit(entry) {
+			return nil
+		}
+	}
+}
+
+// invalidPeerResponse marks decoding errors as errInvalidPeerResponse,
+// leaving errors reading the response as they are.
+func invalidPeerResponse(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+		return fmt.Errorf("%w: %v", errInvalidPeerResponse, err)
+	}
+	return err
+}
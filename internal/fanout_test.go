@@ -0,0 +1,313 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+func Test_fanOut(t *testing.T) {
+	release := make(chan struct{})
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("file") {
+		case "broken.log":
+			w.Write([]byte(`not json`))
+		case "missing.log":
+			http.Error(w, "File does not exist", http.StatusBadRequest)
+		case "slow.log":
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"timestamp":"2024-10-01T13:08:11Z","server":"api-2","message":"payment failed","type":"json","fields":{"order_id":9007199254740993}}]`))
+		}
+	}))
+	defer peer.Close()
+	defer close(release)
+	host := strings.TrimPrefix(peer.URL, "http://")
+
+	// a peer that is not listening
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadHost := strings.TrimPrefix(dead.URL, "http://")
+	dead.Close()
+
+	a := &AppHandler{Client: peer.Client()}
+	want := []types.LogEntry{
+		{
+			Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
+			Server:    "api-2",
+			Message:   "payment failed",
+			Type:      "json",
+			Fields:    map[string]any{"order_id": json.Number("9007199254740993")},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		peers    []string
+		file     string
+		workers  int
+		timeout  time.Duration
+		wantLogs []types.LogEntry
+		wantErr  string
+	}{
+		{
+			name:     "Peer answers",
+			peers:    []string{host},
+			file:     "system.log",
+			workers:  1,
+			wantLogs: want,
+		},
+		{
+			name:    "Peer returns an invalid body",
+			peers:   []string{host},
+			file:    "broken.log",
+			workers: 1,
+			wantErr: "invalid response",
+		},
+		{
+			name:    "Peer returns an error status",
+			peers:   []string{host},
+			file:    "missing.log",
+			workers: 1,
+			wantErr: "unexpected status 400 Bad Request: File does not exist",
+		},
+		{
+			name:    "Peer is down",
+			peers:   []string{deadHost},
+			file:    "system.log",
+			workers: 1,
+			wantErr: "connection refused",
+		},
+		{
+			name:    "Peer does not answer in time",
+			peers:   []string{host},
+			file:    "slow.log",
+			workers: 1,
+			timeout: 50 * time.Millisecond,
+			wantErr: context.DeadlineExceeded.Error(),
+		},
+		{
+			name:    "Waiting for a worker past the deadline",
+			peers:   []string{host, host},
+			file:    "slow.log",
+			workers: 0,
+			timeout: 50 * time.Millisecond,
+			wantErr: context.DeadlineExceeded.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			options := peerOptions{workers: tt.workers, timeout: time.Second}
+			streams := a.fanOut(ctx, tt.peers, RequestParams{fileName: tt.file, lines: 10}, options)
+			if len(streams) != len(tt.peers) {
+				t.Fatalf("fanOut() returned %d streams, want %d", len(streams), len(tt.peers))
+			}
+			for i, stream := range streams {
+				if stream.peer != tt.peers[i] {
+					t.Errorf("fanOut() stream %d is for %s, want %s", i, stream.peer, tt.peers[i])
+				}
+				logs, err := drain(stream)
+				if tt.wantErr == "" {
+					if err != nil || !reflect.DeepEqual(logs, tt.wantLogs) {
+						t.Errorf("fanOut() = %v, %v, want %v", logs, err, tt.wantLogs)
+					}
+				} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("fanOut() error = %v, want %q", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+// drain reads a stream to the end.
+func drain(stream *peerStream) ([]types.LogEntry, error) {
+	var logs []types.LogEntry
+	for {
+		entry, ok := stream.next()
+		if !ok {
+			_, _, err := stream.result()
+			return logs, err
+		}
+		logs = append(logs, entry)
+	}
+}
+
+func Test_openPeer(t *testing.T) {
+	var requests atomic.Int32
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch r.URL.Path {
+		case "/flaky":
+			if n == 1 {
+				http.Error(w, "overloaded", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`[]`))
+		case "/hanging":
+			if n == 1 {
+				<-r.Context().Done()
+				return
+			}
+			w.Write([]byte(`[]`))
+		case "/bad-request":
+			http.Error(w, "invalid filter", http.StatusBadRequest)
+		default:
+			http.Error(w, "down", http.StatusBadGateway)
+		}
+	}))
+	defer peer.Close()
+	a := &AppHandler{Client: peer.Client()}
+	options := peerOptions{timeout: 100 * time.Millisecond, retries: 2, backoff: time.Millisecond}
+
+	tests := []struct {
+		name         string
+		path         string
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "Server error is retried", path: "/flaky", wantAttempts: 2, wantErr: false},
+		{name: "Attempt timeout is retried", path: "/hanging", wantAttempts: 2, wantErr: false},
+		{name: "Client error is not retried", path: "/bad-request", wantAttempts: 1, wantErr: true},
+		{name: "Retries are bounded", path: "/down", wantAttempts: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			resp, attempts, err := a.openPeer(context.Background(), peer.URL+tt.path, options.timeout, options)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("openPeer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("openPeer() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func Test_fanOut_circuitBreaker(t *testing.T) {
+	var requests atomic.Int32
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer peer.Close()
+	host := strings.TrimPrefix(peer.URL, "http://")
+
+	a := &AppHandler{Client: peer.Client(), Breaker: NewCircuitBreaker(2, time.Minute)}
+	options := peerOptions{workers: 1, timeout: time.Second}
+	for i := 0; i < 2; i++ {
+		if _, err := drain(a.fanOut(context.Background(), []string{host}, RequestParams{lines: 1}, options)[0]); err == nil || errors.Is(err, errCircuitOpen) {
+			t.Fatalf("fanOut() request %d error = %v, want the peer's error", i, err)
+		}
+	}
+	_, err := drain(a.fanOut(context.Background(), []string{host}, RequestParams{lines: 1}, options)[0])
+	if !errors.Is(err, errCircuitOpen) {
+		t.Errorf("fanOut() after repeated failures error = %v, want %v", err, errCircuitOpen)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("peer got %d requests, want 2", got)
+	}
+}
+
+func Test_fanOut_maxWait(t *testing.T) {
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"timestamp":"2024-10-01T13:08:11Z","server":"api-2","message":"fast"}]`))
+	}))
+	defer fast.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	peers := []string{strings.TrimPrefix(slow.URL, "http://"), strings.TrimPrefix(fast.URL, "http://")}
+
+	a := &AppHandler{Client: fast.Client(), Breaker: NewCircuitBreaker(1, time.Minute)}
+	options := peerOptions{workers: 2, timeout: 10 * time.Second, maxWait: 50 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	start := time.Now()
+	streams := a.fanOut(ctx, peers, RequestParams{lines: 1}, options)
+	_, slowErr := drain(streams[0])
+	fastLogs, fastErr := drain(streams[1])
+	cancel()
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("fanOut() took %v, want it to return after max_wait", elapsed)
+	}
+	if !errors.Is(slowErr, errPeerPending) {
+		t.Errorf("fanOut() slow peer error = %v, want %v", slowErr, errPeerPending)
+	}
+	if fastErr != nil || len(fastLogs) != 1 {
+		t.Errorf("fanOut() fast peer = %v, %v, want its entry", fastLogs, fastErr)
+	}
+	// being slow is not a failure
+	if !a.Breaker.allow(peers[0], time.Now()) {
+		t.Errorf("pending peer was counted as failed")
+	}
+}
+
+func Test_fanOut_ndjson(t *testing.T) {
+	release := make(chan struct{})
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != ndjsonContentType {
+			t.Errorf("Accept = %q, want %q", r.Header.Get("Accept"), ndjsonContentType)
+		}
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.Header().Set(entryCountHeader, "3")
+		w.Write([]byte(`{"timestamp":"2024-10-01T13:08:12Z","server":"api-2","message":"second"}` + "\n"))
+		w.Write([]byte(`{"timestamp":"2024-10-01T13:08:11Z","server":"api-2","message":"first"}` + "\n"))
+		w.(http.Flusher).Flush()
+		// the rest of the page takes a while
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer peer.Close()
+	defer close(release)
+
+	a := &AppHandler{Client: peer.Client()}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	streams := a.fanOut(ctx, []string{strings.TrimPrefix(peer.URL, "http://")}, RequestParams{lines: 2}, peerOptions{workers: 1, timeout: 5 * time.Second})
+
+	local := sliceSource{{Timestamp: time.Date(2024, time.October, 1, 13, 8, 0, 0, time.UTC), Server: "api", Message: "local"}}
+	start := time.Now()
+	logs := mergeNewest([]entrySource{&local, streams[0]}, 2)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("mergeNewest() took %v, want it to return before the peer finished", elapsed)
+	}
+	var got []string
+	for _, entry := range logs {
+		got = append(got, entry.Message)
+	}
+	if want := []string{"second", "first"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeNewest() = %q, want %q", got, want)
+	}
+	if _, _, err := streams[0].result(); err != nil {
+		t.Errorf("peer stopped early reported %v, want no error", err)
+	}
+	// the page the peer returned, not the entries the merge took
+	if count := streams[0].entryCount(); count != 3 {
+		t.Errorf("entryCount() = %d, want 3", count)
+	}
+}
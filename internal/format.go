@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// Output formats of /api/v1/logs
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatText   = "text"
+)
+
+var errInvalidFormat = errors.New("invalid format, use json, ndjson, csv or text")
+
+var formatContentTypes = map[string]string{
+	formatJSON:   "application/json",
+	formatNDJSON: ndjsonContentType,
+	formatCSV:    "text/csv",
+	formatText:   "text/plain",
+}
+
+// negotiateFormat picks the output format from the format parameter or,
+// without one, the media type of the Accept header with a format and the
+// highest q value, the first of them on a tie. Media types with q=0 are
+// refused. JSON is used when nothing else is asked for.
+func negotiateFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := formatContentTypes[format]; !ok {
+			return "", errInvalidFormat
+		}
+		return format, nil
+	}
+	best, bestWeight := formatJSON, 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accepted)
+		if err != nil {
+			continue
+		}
+		weight := 1.0
+		if value, ok := params["q"]; ok {
+			if weight, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		for format, contentType := range formatContentTypes {
+			if mediaType == contentType && weight > bestWeight {
+				best, bestWeight = format, weight
+			}
+		}
+	}
+	return best, nil
+}
+
+// writeLogs writes logs in format. Line oriented formats are written entry
+// by entry instead of being built up in memory, and list the context of a
+// match around it like grep does.
+func writeLogs(w http.ResponseWriter, logs []types.LogEntry, format string) error {
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	switch format {
+	case formatNDJSON:
+		return writeNDJSON(w, logs)
+	case formatCSV:
+		return writeCSV(w, logs)
+	case formatText:
+		return writeText(w, logs)
+	default:
+		return json.NewEncoder(w).Encode(logs)
+	}
+}
+
+// writeNDJSON writes one entry per line.
+func writeNDJSON(w io.Writer, logs []types.LogEntry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range logs {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var csvHeader = []string{"timestamp", "server", "level", "type", "message", "context"}
+
+// writeCSV writes a row per entry. The context column tells the entries
+// before and after a match from the match.
+func writeCSV(w io.Writer, logs []types.LogEntry) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, entry := range logs {
+		for _, row := range withContextRows(entry) {
+			record := []string{formatTimestamp(row.entry.Timestamp), row.entry.Server, row.entry.Level, string(row.entry.Type), row.entry.Message, row.context}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeText writes every line of an entry prefixed by its server and time,
+// so entries can be piped into grep and awk. The syslog hostname and tag
+// the parser took off the message are put back, like journalctl shows
+// them. Like grep, matches are separated by "--" when they come with
+// context.
+func writeText(w io.Writer, logs []types.LogEntry) error {
+	grouped := false
+	for _, entry := range logs {
+		grouped = grouped || len(entry.Before) > 0 || len(entry.After) > 0
+	}
+	for i, entry := range logs {
+		if grouped && i > 0 {
+			if _, err := io.WriteString(w, "--\n"); err != nil {
+				return err
+			}
+		}
+		for _, row := range withContextRows(entry) {
+			prefix := row.entry.Server + " " + formatTimestamp(row.entry.Timestamp) + " "
+			for _, line := range strings.Split(syslogHeader(row.entry)+row.entry.Message, "\n") {
+				if _, err := io.WriteString(w, prefix+line+"\n"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// syslogHeader returns the "host app[pid]: " an entry's message followed
+// in its line, empty for entries without them.
+func syslogHeader(entry types.LogEntry) string {
+	var header strings.Builder
+	if entry.Hostname != "" {
+		header.WriteString(entry.Hostname + " ")
+	}
+	if entry.AppName != "" {
+		header.WriteString(entry.AppName)
+		if entry.ProcID != "" {
+			header.WriteString("[" + entry.ProcID + "]")
+		}
+		header.WriteString(": ")
+	}
+	return header.String()
+}
+
+type contextRow struct {
+	entry   types.LogEntry
+	context string
+}
+
+// withContextRows lists a match with the entries around it in file order.
+func withContextRows(entry types.LogEntry) []contextRow {
+	rows := make([]contextRow, 0, len(entry.Before)+1+len(entry.After))
+	for _, before := range entry.Before {
+		rows = append(rows, contextRow{before, "before"})
+	}
+	rows = append(rows, contextRow{entry, ""})
+	for _, after := range entry.After {
+		rows = append(rows, contextRow{after, "after"})
+	}
+	return rows
+}
+
+// formatTimestamp returns "-" for lines without a time.
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339Nano)
+}
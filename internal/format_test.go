@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+func Test_negotiateFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		accept  string
+		want    string
+		wantErr bool
+	}{
+		{name: "Default", want: formatJSON},
+		{name: "Browser", accept: "text/html,application/xhtml+xml,*/*;q=0.8", want: formatJSON},
+		{name: "NDJSON", accept: "application/x-ndjson", want: formatNDJSON},
+		{name: "First known type wins", accept: "text/html, text/csv; charset=utf-8, text/plain", want: formatCSV},
+		{name: "Refused type", accept: "text/csv;q=0, application/json", want: formatJSON},
+		{name: "Highest weight wins", accept: "text/plain;q=0.5, text/csv;q=0.9, application/x-ndjson;q=0.1", want: formatCSV},
+		{name: "Weight 1 by default", accept: "text/csv;q=0.9, text/plain", want: formatText},
+		{name: "Invalid weight", accept: "text/csv;q=high, text/plain;q=0.2", want: formatText},
+		{name: "Parameter overrides the header", query: "format=text", accept: "text/csv", want: formatText},
+		{name: "Unknown format", query: "format=xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/logs?"+tt.query, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			got, err := negotiateFormat(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("negotiateFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("negotiateFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_writeLogs(t *testing.T) {
+	at := func(sec int) time.Time {
+		return time.Date(2024, time.October, 1, 13, 8, sec, 0, time.UTC)
+	}
+	logs := []types.LogEntry{
+		{Timestamp: at(11), Server: "api-2", Message: "payment failed\n  at checkout", Type: "json", Level: "error"},
+		{Timestamp: at(9), Server: "api", Message: `user "bob", logged in`, Type: types.System},
+	}
+	withContext := []types.LogEntry{
+		{
+			Timestamp: at(11), Server: "api", Message: "error", Type: types.System,
+			Before: []types.LogEntry{{Timestamp: at(10), Server: "api", Message: "retrying", Type: types.System}},
+		},
+		{Timestamp: at(5), Server: "api", Message: "error", Type: types.System},
+		{Server: "api", Message: "garbage", ParseError: true},
+	}
+
+	tests := []struct {
+		name            string
+		logs            []types.LogEntry
+		format          string
+		wantContentType string
+		want            string
+	}{
+		{
+			name:            "JSON",
+			logs:            logs[1:],
+			format:          formatJSON,
+			wantContentType: "application/json",
+			want:            `[{"timestamp":"2024-10-01T13:08:09Z","server":"api","message":"user \"bob\", logged in","type":"system"}]` + "\n",
+		},
+		{
+			name:            "NDJSON",
+			logs:            logs,
+			format:          formatNDJSON,
+			wantContentType: "application/x-ndjson",
+			want: `{"timestamp":"2024-10-01T13:08:11Z","server":"api-2","message":"payment failed\n  at checkout","type":"json","level":"error"}` + "\n" +
+				`{"timestamp":"2024-10-01T13:08:09Z","server":"api","message":"user \"bob\", logged in","type":"system"}` + "\n",
+		},
+		{
+			name:            "CSV",
+			logs:            logs,
+			format:          formatCSV,
+			wantContentType: "text/csv",
+			want: "timestamp,server,level,type,message,context\n" +
+				"2024-10-01T13:08:11Z,api-2,error,json,\"payment failed\n  at checkout\",\n" +
+				"2024-10-01T13:08:09Z,api,,system,\"user \"\"bob\"\", logged in\",\n",
+		},
+		{
+			name:            "CSV with context",
+			logs:            withContext[:1],
+			format:          formatCSV,
+			wantContentType: "text/csv",
+			want: "timestamp,server,level,type,message,context\n" +
+				"2024-10-01T13:08:10Z,api,,system,retrying,before\n" +
+				"2024-10-01T13:08:11Z,api,,system,error,\n",
+		},
+		{
+			name:            "Text",
+			logs:            logs,
+			format:          formatText,
+			wantContentType: "text/plain",
+			want: "api-2 2024-10-01T13:08:11Z payment failed\n" +
+				"api-2 2024-10-01T13:08:11Z   at checkout\n" +
+				"api 2024-10-01T13:08:09Z user \"bob\", logged in\n",
+		},
+		{
+			name: "Text with syslog header",
+			logs: []types.LogEntry{
+				{Timestamp: at(11), Server: "api", Message: "ASL Sender Statistics", Type: types.System, Hostname: "bipen-14QM", AppName: "syslogd", ProcID: "124"},
+				{Timestamp: at(12), Server: "api", Message: "disk full", Type: types.System, AppName: "kernel"},
+			},
+			format:          formatText,
+			wantContentType: "text/plain",
+			want: "api 2024-10-01T13:08:11Z bipen-14QM syslogd[124]: ASL Sender Statistics\n" +
+				"api 2024-10-01T13:08:12Z kernel: disk full\n",
+		},
+		{
+			name:            "Text with context",
+			logs:            withContext,
+			format:          formatText,
+			wantContentType: "text/plain",
+			want: "api 2024-10-01T13:08:10Z retrying\n" +
+				"api 2024-10-01T13:08:11Z error\n" +
+				"--\n" +
+				"api 2024-10-01T13:08:05Z error\n" +
+				"--\n" +
+				"api - garbage\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := writeLogs(w, tt.logs, tt.format); err != nil {
+				t.Fatalf("writeLogs() error = %v", err)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("writeLogs() Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("writeLogs() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,14 +2,15 @@ package internal
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,63 +18,203 @@ import (
 	"github.com/a-h/templ"
 	"github.com/bipinshashi/log-collection/internal/components"
 	"github.com/bipinshashi/log-collection/internal/config"
+	"github.com/bipinshashi/log-collection/internal/discovery"
+	"github.com/bipinshashi/log-collection/internal/parser"
+	"github.com/bipinshashi/log-collection/internal/query"
 	"github.com/bipinshashi/log-collection/internal/types"
 	"github.com/bipinshashi/log-collection/internal/utils"
 )
 
 type AppHandler struct {
 	Client *http.Client
+	// Breaker skips peers that keep failing, it may be nil
+	Breaker *CircuitBreaker
+	// Scans bounds concurrent reads of log files, it may be nil
+	Scans *ScanLimiter
+	// Index speeds up queries with an end time, it may be nil
+	Index *IndexStore
+	// Peers finds the peers to query, PEERS is used when it is nil
+	Peers discovery.Source
+	// Registry holds the peers that registered themselves, registration is
+	// turned off when it is nil
+	Registry *discovery.Registry
+	// RegistrationToken has to be sent by peers registering themselves
+	RegistrationToken string
 }
 
 type RequestParams struct {
 	fileName string
 	lines    int
 	filter   string
+	query    *query.Query
+	follow   bool
+	since    time.Time
+	until    time.Time
+	before   int
+	after    int
+	level    string
+	cursor   *pageCursor
+	partial  bool
+	maxWait  time.Duration
+	// budget bounds the work done for the request, nil for no bound
+	budget *queryBudget
+	// index finds where to start reading for until, it may be nil
+	index *IndexStore
+	// orderedUpTo is how many bytes from the start of the file are known to
+	// be in chronological order, so reading may stop at since
+	orderedUpTo int64
+	// trace lists the servers the request passed through, this one last
+	trace []string
 }
 
 const (
-	logDir             = "/var/log/"
 	defaultLogFileName = "system.log"
 	defaultLines       = 10
+	defaultMaxWait     = time.Second
+	maxLineSize        = 1024 * 1024
+	maxContextLines    = 100
 )
 
-var LogEntryTypeTimePart = map[types.LogEntryType]types.LogEntryTypeConfig{
-	types.System: {Layout: "Jan 2 15:04:05", Part: 3},
-	types.Wifi:   {Layout: "Mon Jan 2 15:04:05.000", Part: 4},
-}
+// logDir is where log files are read from.
+var logDir = "/var/log/"
 
 var globalLogs types.GlobalLogState
 
+// now is replaced in tests to make relative times deterministic.
+var now = time.Now
+
+// logPage is a page of entries merged from this server and its peers.
+type logPage struct {
+	logs    []types.LogEntry
+	next    *pageCursor
+	servers []types.ServerStatus
+}
+
 func (a *AppHandler) ShowDemo(w http.ResponseWriter, r *http.Request) {
+	// show what the servers have to say right away rather than wait for
+	// the slowest one
+	if values := r.URL.Query(); values.Get("partial") == "" && values.Get("max_wait") == "" {
+		values.Set("partial", "true")
+		r.URL.RawQuery = values.Encode()
+	}
 	// Update state.
 	r.ParseForm()
-	logs, shouldReturn := a.getLogsHelper(r, w)
+	page, shouldReturn := a.getLogsHelper(r, w)
 	if shouldReturn {
 		return
 	}
-	globalLogs.Entries = logs
+	globalLogs.Entries = page.logs
+	globalLogs.Servers = page.servers
 	component := components.Page(globalLogs)
 	templ.Handler(component).ServeHTTP(w, r)
 }
 
 func (a *AppHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
+	if follow, _ := strconv.ParseBool(r.URL.Query().Get("follow")); follow {
+		a.StreamLogs(w, r)
+		return
+	}
+	format, err := negotiateFormat(r)
+	if err != nil {
+		returnBadRequest(err.Error(), w)
+		return
+	}
+
 	// update global logs
-	logs, shouldReturn := a.getLogsHelper(r, w)
+	page, shouldReturn := a.getLogsHelper(r, w)
+	if shouldReturn {
+		return
+	}
+
+	w.Header().Set("X-Parse-Errors", strconv.Itoa(countParseErrors(page.logs)))
+	w.Header().Set(entryCountHeader, strconv.Itoa(len(page.logs)))
+	if reason := truncatedReason(page.servers); reason != "" {
+		w.Header().Set(truncatedHeader, reason)
+	}
+	if page.next != nil {
+		w.Header().Set("X-Next-Cursor", page.next.encode())
+	}
+	writeLogs(w, page.logs, format)
+}
+
+// GetLogsV2 returns the same entries as GetLogs wrapped in an envelope that
+// also reports the status of every server and the cursor for the next page.
+func (a *AppHandler) GetLogsV2(w http.ResponseWriter, r *http.Request) {
+	if follow, _ := strconv.ParseBool(r.URL.Query().Get("follow")); follow {
+		a.StreamLogs(w, r)
+		return
+	}
+
+	page, shouldReturn := a.getLogsHelper(r, w)
 	if shouldReturn {
 		return
 	}
 
+	response := newLogsResponse(page)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(logs)
-	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
 }
 
-func (a *AppHandler) getLogsHelper(r *http.Request, w http.ResponseWriter) ([]types.LogEntry, bool) {
+func newLogsResponse(page logPage) types.LogsResponse {
+	response := types.LogsResponse{
+		Entries: page.logs,
+		Servers: page.servers,
+	}
+	if response.Entries == nil {
+		response.Entries = []types.LogEntry{}
+	}
+	if page.next != nil {
+		response.NextCursor = page.next.encode()
+	}
+	for _, server := range page.servers {
+		// a server in a loop is one the request came through, which returns
+		// its own entries
+		if server.Status != types.StatusOK && server.Status != types.StatusLoop {
+			response.Truncated = true
+			response.Warnings = append(response.Warnings, fmt.Sprintf("no entries from %s: %s", server.Name, server.Error))
+		}
+	}
+	if reason := truncatedReason(page.servers); reason != "" {
+		response.Truncated = true
+		response.TruncatedReason = reason
+		for _, server := range page.servers {
+			if server.Truncated != "" {
+				response.Warnings = append(response.Warnings, fmt.Sprintf("%s stopped reading at its %s limit", server.Name, server.Truncated))
+			}
+		}
+	}
+	if parseErrors := countParseErrors(page.logs); parseErrors > 0 {
+		response.Warnings = append(response.Warnings, fmt.Sprintf("lines that could not be parsed: %d", parseErrors))
+	}
+	return response
+}
+
+func countParseErrors(logs []types.LogEntry) int {
+	parseErrors := 0
+	for _, entry := range logs {
+		if entry.ParseError {
+			parseErrors++
+		}
+	}
+	return parseErrors
+}
+
+// getLogsHelper returns the requested page of entries from this server and
+// its peers, the cursor for the next page if there is one and the status
+// of every server.
+func (a *AppHandler) getLogsHelper(r *http.Request, w http.ResponseWriter) (logPage, bool) {
+	received := time.Now()
 	params, err := validateQueryParams(r.URL.Query())
 	if err != nil {
 		returnBadRequest(err.Error(), w)
-		return nil, true
+		return logPage{}, true
 	}
+	params.trace, err = requestTrace(r, instanceID)
+	if err != nil {
+		refuseLoop(w, err)
+		return logPage{}, true
+	}
+	params.budget = newQueryBudget(config.GetConfig(), received)
 
 	filePath, err := utils.ValidateFilePath(logDir, params.fileName)
 	if err != nil {
@@ -85,65 +226,144 @@ func (a *AppHandler) getLogsHelper(r *http.Request, w http.ResponseWriter) ([]ty
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			w.WriteHeader(http.StatusInternalServerError)
 		}
-		return nil, true
+		return logPage{}, true
 	}
 
-	file, err := os.Open(filePath)
+	source, err := newLogSource(params)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		w.WriteHeader(http.StatusInternalServerError)
-		return nil, true
+		return logPage{}, true
+	}
+	start := time.Now()
+	logs, err := a.scan(r.Context(), filePath, params, source)
+	if errors.Is(err, errScanQueueFull) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return logPage{}, true
 	}
-	defer file.Close()
-
-	server := config.GetConfig().ServerName
-	logs, err := readLastNLines(file, params, server)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		w.WriteHeader(http.StatusInternalServerError)
-		return nil, true
+		return logPage{}, true
+	}
+	servers := []types.ServerStatus{{
+		Name:       source.server,
+		Status:     types.StatusOK,
+		LatencyMS:  time.Since(start).Milliseconds(),
+		EntryCount: len(logs),
+		Truncated:  params.budget.truncated(),
+	}}
+
+	// the local scan has already used up part of the time the response has
+	ctx, cancel := context.WithDeadline(r.Context(), received.Add(peerFanOutTimeout))
+	defer cancel()
+	logs, peers := a.mergePeerLogs(ctx, logs, params)
+	servers = append(servers, peers...)
+	truncated := false
+	for _, server := range servers {
+		truncated = truncated || server.Truncated != ""
 	}
 
-	logs = a.appendPeerLogs(logs, params)
-
-	sort.Slice(logs, func(i, j int) bool {
-		return logs[i].Timestamp.After(logs[j].Timestamp)
-	})
+	return logPage{
+		logs:    logs,
+		next:    nextCursor(params.cursor, logs, params.lines, truncated),
+		servers: servers,
+	}, false
+}
 
-	if len(logs) > params.lines {
-		logs = logs[0:params.lines]
+// scan reads the entries of filePath within the request's budget, once one
+// of the limited scan slots is free.
+func (a *AppHandler) scan(ctx context.Context, filePath string, params RequestParams, source logSource) ([]types.LogEntry, error) {
+	// waiting for a slot counts against the time the request may take
+	if params.budget != nil && !params.budget.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, params.budget.deadline)
+		defer cancel()
+	}
+	if err := a.Scans.acquire(ctx); err != nil {
+		return nil, errScanQueueFull
 	}
+	defer a.Scans.release()
+	params.index = a.Index
+	return readLastNLinesRotated(filePath, params, source)
+}
 
-	return logs, false
+// truncatedReason returns the first limit a server stopped reading at.
+func truncatedReason(servers []types.ServerStatus) string {
+	for _, server := range servers {
+		if server.Truncated != "" {
+			return server.Truncated
+		}
+	}
+	return ""
 }
 
-func (a *AppHandler) appendPeerLogs(logs []types.LogEntry, params RequestParams) []types.LogEntry {
+// mergePeerLogs merges the entries of every peer with logs, the entries of
+// this server, into the n newest, and returns how each peer answered, in
+// the configured order. The merge keeps the entries of each server in file
+// order, so the cursor can point at the last one returned.
+func (a *AppHandler) mergePeerLogs(ctx context.Context, logs []types.LogEntry, params RequestParams) ([]types.LogEntry, []types.ServerStatus) {
+	local := sliceSource(logs)
+	sources := []entrySource{&local}
+
 	config := config.GetConfig()
-	if config.Peers == "" {
-		return logs
+	var peers []string
+	// deep enough down the tree, answer for this server only
+	if len(params.trace) <= config.MaxFanOutDepth {
+		peers = a.peers(ctx)
 	}
-
-	// use a go channel to concurrently call peers
-	jobs := make(chan string, len(strings.Split(config.Peers, ",")))
-	peerLogResponses := make(chan []types.LogEntry, len(strings.Split(config.Peers, ",")))
-	for _, peer := range strings.Split(config.Peers, ",") {
-		url := getUrlForPeer(peer, params)
-		jobs <- url
+	if len(peers) == 0 {
+		return mergeNewest(sources, params.lines), nil
 	}
-	close(jobs)
 
-	// worker pool to concurrently fetch logs from peers
-	workercount := config.WorkerCount
-	for w := 1; w <= workercount; w++ {
-		go a.worker(jobs, peerLogResponses)
+	options, err := peerOptionsFromConfig(config)
+	if err != nil {
+		// checked at startup, so this does not happen
+		log.Println(err)
+		options.timeout = config.PeerTimeout
 	}
-
-	// wait for all peers to respond
-	for i := 0; i < len(strings.Split(config.Peers, ",")); i++ {
-		peerLogs := <-peerLogResponses
-		logs = append(logs, peerLogs...)
+	if params.partial {
+		options.maxWait = params.maxWait
+	}
+	options.trace = params.trace
+
+	// stops the peers that are still sending entries once the merge is done
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	streams := a.fanOut(ctx, peers, params, options)
+	for _, stream := range streams {
+		sources = append(sources, stream)
 	}
-	return logs
+	logs = mergeNewest(sources, params.lines)
+
+	var statuses []types.ServerStatus
+	for _, stream := range streams {
+		attempts, latency, err := stream.result()
+		status := types.ServerStatus{
+			Name:       stream.peer,
+			Status:     types.StatusOK,
+			LatencyMS:  latency.Milliseconds(),
+			EntryCount: stream.entryCount(),
+			Attempts:   attempts,
+			Truncated:  stream.truncated(),
+		}
+		switch {
+		case errors.Is(err, errCircuitOpen):
+			status.Status = types.StatusCircuitOpen
+			status.Error = err.Error()
+		case errors.Is(err, errRequestLoop):
+			status.Status = types.StatusLoop
+			status.Error = err.Error()
+		case errors.Is(err, errPeerPending):
+			status.Status = types.StatusPending
+			status.Error = err.Error()
+		case err != nil:
+			status.Status = types.StatusError
+			status.Error = err.Error()
+		}
+		statuses = append(statuses, status)
+	}
+	return logs, statuses
 }
 
 func validateQueryParams(values url.Values) (RequestParams, error) {
@@ -163,7 +383,80 @@ func validateQueryParams(values url.Values) (RequestParams, error) {
 	// sanitize filter query
 	filter := values.Get("filter")
 	filter = strings.TrimSpace(filter)
-	filter = strings.ToLower(filter)
+	var filterQuery *query.Query
+	if filter != "" {
+		var err error
+		filterQuery, err = query.Parse(filter)
+		if err != nil {
+			return RequestParams{}, err
+		}
+	}
+
+	follow := false
+	if followStr := values.Get("follow"); followStr != "" {
+		var err error
+		follow, err = strconv.ParseBool(followStr)
+		if err != nil {
+			return RequestParams{}, errors.New("invalid follow value")
+		}
+	}
+
+	since, err := parseTimeParam(values.Get("since"))
+	if err != nil {
+		return RequestParams{}, errors.New("invalid since value")
+	}
+	until, err := parseTimeParam(values.Get("until"))
+	if err != nil {
+		return RequestParams{}, errors.New("invalid until value")
+	}
+	if !since.IsZero() && !until.IsZero() && since.After(until) {
+		return RequestParams{}, errors.New("since should be before until")
+	}
+
+	before, err := parseContextParam(values.Get("before"))
+	if err != nil {
+		return RequestParams{}, err
+	}
+	after, err := parseContextParam(values.Get("after"))
+	if err != nil {
+		return RequestParams{}, err
+	}
+
+	level := ""
+	if levelStr := values.Get("level"); levelStr != "" {
+		var ok bool
+		level, ok = parser.NormalizeLevel(levelStr)
+		if !ok {
+			return RequestParams{}, errors.New("invalid level")
+		}
+	}
+
+	var cursor *pageCursor
+	if cursorStr := values.Get("cursor"); cursorStr != "" {
+		cursor, err = parseCursor(cursorStr)
+		if err != nil {
+			return RequestParams{}, err
+		}
+	}
+
+	// max_wait on its own asks for partial results as well
+	partial := values.Get("max_wait") != ""
+	if partialStr := values.Get("partial"); partialStr != "" {
+		partial, err = strconv.ParseBool(partialStr)
+		if err != nil {
+			return RequestParams{}, errors.New("invalid partial value")
+		}
+	}
+	var maxWait time.Duration
+	if partial {
+		maxWait = defaultMaxWait
+		if maxWaitStr := values.Get("max_wait"); maxWaitStr != "" {
+			maxWait, err = time.ParseDuration(maxWaitStr)
+			if err != nil || maxWait <= 0 {
+				return RequestParams{}, errors.New("invalid max_wait value")
+			}
+		}
+	}
 
 	filename := values.Get("file")
 	if filename == "" {
@@ -172,99 +465,266 @@ func validateQueryParams(values url.Values) (RequestParams, error) {
 	params := RequestParams{
 		fileName: filename,
 		filter:   filter,
+		query:    filterQuery,
 		lines:    n,
+		follow:   follow,
+		since:    since,
+		until:    until,
+		before:   before,
+		after:    after,
+		level:    level,
+		cursor:   cursor,
+		partial:  partial,
+		maxWait:  maxWait,
 	}
 
 	return params, nil
 }
 
+// parseContextParam parses the number of entries to return before or after
+// each match.
+func parseContextParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("invalid number of context lines")
+	}
+	if n < 0 || n > maxContextLines {
+		return 0, errors.New("number of context lines should be between 0 and 100")
+	}
+	return n, nil
+}
+
+// parseTimeParam parses an RFC3339 timestamp or a duration relative to now
+// such as 15m, 2h or 1d.
+func parseTimeParam(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, errors.New("invalid duration")
+		}
+		return now().AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if d < 0 {
+		return time.Time{}, errors.New("invalid duration")
+	}
+	return now().Add(-d), nil
+}
+
 func getUrlForPeer(peer string, params RequestParams) string {
-	lines := params.lines
-	linesStr := strconv.Itoa(lines)
-	url := "http://" + peer + "/api/v1/logs?n=" + linesStr + "&file=" + params.fileName + "&filter=" + params.filter
-	return url
+	return "http://" + peer + "/api/v1/logs?" + peerQuery(params)
 }
 
-func (a *AppHandler) worker(jobs <-chan string, peerLogResponses chan<- []types.LogEntry) {
-	for url := range jobs {
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			log.Println(err)
-			return
+func getStreamUrlForPeer(peer string, params RequestParams) string {
+	return "http://" + peer + "/api/v1/logs/stream?" + peerQuery(params)
+}
+
+func peerQuery(params RequestParams) string {
+	values := url.Values{}
+	values.Set("n", strconv.Itoa(params.lines))
+	values.Set("file", params.fileName)
+	values.Set("filter", params.filter)
+	// relative times are resolved once so every peer queries the same range
+	if !params.since.IsZero() {
+		values.Set("since", params.since.Format(time.RFC3339Nano))
+	}
+	if !params.until.IsZero() {
+		values.Set("until", params.until.Format(time.RFC3339Nano))
+	}
+	if params.level != "" {
+		values.Set("level", params.level)
+	}
+	if params.cursor != nil {
+		values.Set("cursor", params.cursor.encode())
+	}
+	if params.before > 0 {
+		values.Set("before", strconv.Itoa(params.before))
+	}
+	if params.after > 0 {
+		values.Set("after", strconv.Itoa(params.after))
+	}
+	return values.Encode()
+}
+
+func returnBadRequest(errorMsg string, w http.ResponseWriter) {
+	http.Error(w, errorMsg, http.StatusBadRequest)
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+// readLastNLines reads the last n lines of a log file. The file is read
+// backwards from the end and reading stops as soon as n entries pass the
+// filter. If the timestamps turn out not to be in chronological order the
+// whole file is scanned and sorted instead.
+func readLastNLines(file io.ReadSeeker, params RequestParams, source logSource) ([]types.LogEntry, error) {
+	logs, ordered, err := readLastNLinesReverse(file, params, source)
+	if err != nil {
+		return nil, err
+	}
+	if ordered {
+		return logs, nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return readAllLines(file, params, source)
+}
+
+// readLastNLinesReverse collects the last n matching entries by reading the
+// file backwards. It reports false if an entry is newer than one that comes
+// after it in the file, in which case the result cannot be trusted.
+func readLastNLinesReverse(file io.ReadSeeker, params RequestParams, source logSource) ([]types.LogEntry, bool, error) {
+	reader := newReverseLineReader(file, defaultBlockSize)
+	logParser := parser.ForFile(params.fileName)
+
+	collector := newContextCollector(params)
+	// lines that did not parse, newest first, until the entry they follow
+	var following []rawLine
+	followingSize := 0
+	var oldest time.Time
+	// set once reading has gone back past since. Unless the file is known
+	// to be in order there, reading goes on without collecting, in case an
+	// older entry is followed by a newer one further back.
+	pastSince := false
+	for !collector.full() {
+		line, err := reader.Line()
+		if err == io.EOF {
+			break
 		}
-		resp, err := a.Client.Do(req)
 		if err != nil {
-			log.Println(err)
-			return
+			return nil, false, err
+		}
+		entries, size := collector.held()
+		if !params.budget.scan(len(line)+1) || !params.budget.hold(entries+len(following), size+followingSize) {
+			break
 		}
-		defer resp.Body.Close()
-		var logs []types.LogEntry
-		err = json.NewDecoder(resp.Body).Decode(&logs)
+		entry, err := parseLogEntry(string(line), logParser, source)
 		if err != nil {
-			log.Println(err)
-			return
+			following = append(following, rawLine{text: string(line), offset: reader.Offset()})
+			followingSize += len(line)
+			continue
 		}
-		peerLogResponses <- logs
+		if !oldest.IsZero() && entry.Timestamp.After(oldest) {
+			return nil, false, nil
+		}
+		oldest = entry.Timestamp
+		entry.Position = source.position(reader.Offset())
+		if pastSince || !params.since.IsZero() && entry.Timestamp.Before(params.since) && !collector.collecting() {
+			following, followingSize = nil, 0
+			if reader.Offset() < params.orderedUpTo {
+				// everything further back is older still
+				break
+			}
+			pastSince = true
+			continue
+		}
+		collector.addAll(assembleRecord(&entry, reversed(following), logParser, source))
+		following, followingSize = nil, 0
 	}
+	// lines at the start of the file that follow no entry have no time and
+	// sort last
+	if !pastSince {
+		collector.addAll(assembleRecord(nil, reversed(following), logParser, source))
+	}
+	return collector.result(), true, nil
 }
 
-func returnBadRequest(errorMsg string, w http.ResponseWriter) {
-	http.Error(w, errorMsg, http.StatusBadRequest)
-	w.WriteHeader(http.StatusBadRequest)
+func reversed(lines []rawLine) []rawLine {
+	out := make([]rawLine, len(lines))
+	for i, line := range lines {
+		out[len(lines)-1-i] = line
+	}
+	return out
 }
 
-// readLastNLines reads the last n lines of a log file.
-func readLastNLines(file io.Reader, params RequestParams, server string) ([]types.LogEntry, error) {
+// readAllLines scans the whole file and returns its n newest entries,
+// newest first. The newest entries may come last, so it returns none if
+// the budget runs out before the end.
+func readAllLines(file io.Reader, params RequestParams, source logSource) ([]types.LogEntry, error) {
 	// Read the file line by line
-	scanner := bufio.NewScanner(file)
-	var logs []types.LogEntry
-	logType := getLogEntryType(params.fileName)
-
-	for i := 0; scanner.Scan(); i++ {
-		entry := parseLogEntry(scanner.Text(), logType, server)
-		if params.filter != "" && strings.Contains(strings.ToLower(entry.Message), params.filter) {
-			logs = append(logs, entry)
-		} else if params.filter == "" {
-			logs = append(logs, entry)
+	reader := bufio.NewReader(file)
+	grouper := newLineGrouper(parser.ForFile(params.fileName), source)
+	matches := newNewestMatches(params)
+	// where the next line starts
+	var offset int64
+	for {
+		line, n, err := readLine(reader, maxLineSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
 		}
+		entries, size := matches.held()
+		pendingLines, pendingSize := grouper.pending()
+		if !params.budget.scan(n) || !params.budget.hold(entries+pendingLines, size+pendingSize) {
+			// the newest entries come last and have not been read
+			return nil, nil
+		}
+		for _, record := range grouper.add(string(line), offset) {
+			matches.add(record)
+		}
+		offset += int64(n)
 	}
-	sort.Slice(logs, func(i, j int) bool {
-		return logs[i].Timestamp.After(logs[j].Timestamp)
-	})
-	if len(logs) < params.lines {
-		return logs, nil
+	for _, record := range grouper.flush() {
+		matches.add(record)
 	}
-	return logs[0:params.lines], nil
+	return matches.result(), nil
 }
 
-func getLogEntryType(filename string) types.LogEntryType {
-	var logType types.LogEntryType
-	switch {
-	case strings.Contains(filename, "wifi"):
-		logType = types.Wifi
-	case strings.Contains(filename, "system"):
-		logType = types.System
-	default:
-		logType = types.System
-	}
-	return logType
+func matchesFilter(entry types.LogEntry, params RequestParams) bool {
+	if !inTimeRange(entry, params) {
+		return false
+	}
+	if params.level != "" && !parser.LevelAtLeast(entry.Level, params.level) {
+		return false
+	}
+	return params.query == nil || params.query.Match(entry)
 }
 
-func parseLogEntry(line string, logType types.LogEntryType, server string) types.LogEntry {
-	parts := strings.Fields(line)
-	logEntryTypeConfig := types.LogEntryTypeTimePart[logType]
-	if len(parts) < logEntryTypeConfig.Part {
-		return types.LogEntry{}
+// inTimeRange reports whether entry falls between since and until. Entries
+// without a timestamp never match a time range.
+func inTimeRange(entry types.LogEntry, params RequestParams) bool {
+	if params.since.IsZero() && params.until.IsZero() {
+		return true
+	}
+	if entry.Timestamp.IsZero() {
+		return false
+	}
+	if !params.since.IsZero() && entry.Timestamp.Before(params.since) {
+		return false
 	}
-	timestamp, err := time.Parse(logEntryTypeConfig.Layout, strings.Join(parts[0:logEntryTypeConfig.Part], " "))
+	return params.until.IsZero() || !entry.Timestamp.After(params.until)
+}
+
+func newLogSource(params RequestParams) (logSource, error) {
+	config := config.GetConfig()
+	location, err := config.Location(params.fileName)
 	if err != nil {
-		return types.LogEntry{}
+		return logSource{}, err
 	}
-	message := strings.Join(parts, " ")
-	return types.LogEntry{
-		Timestamp: timestamp,
-		Server:    server,
-		Message:   message,
-		Type:      logType,
+	return logSource{server: config.ServerName, instance: instanceID, location: location}, nil
+}
+
+// parseLogEntry parses line with p and resolves its timestamp for source.
+func parseLogEntry(line string, p parser.Parser, source logSource) (types.LogEntry, error) {
+	entry, err := p.Parse(line)
+	if err != nil {
+		return types.LogEntry{}, err
 	}
+	entry.Timestamp = source.resolve(entry.Timestamp)
+	entry.Server = source.server
+	return entry, nil
 }
@@ -7,31 +7,48 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bipinshashi/log-collection/internal/parser"
+	"github.com/bipinshashi/log-collection/internal/query"
 	"github.com/bipinshashi/log-collection/internal/types"
 )
 
+func mustParseQuery(s string) *query.Query {
+	q, err := query.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+var testSource = logSource{
+	server:   "api",
+	location: time.UTC,
+	modTime:  time.Date(2024, time.October, 2, 0, 0, 0, 0, time.UTC),
+}
+
 func Test_parseLogEntry(t *testing.T) {
 	type args struct {
 		line    string
 		logType types.LogEntryType
-		server  string
+		source  logSource
 	}
 	tests := []struct {
-		name string
-		args args
-		want types.LogEntry
+		name    string
+		args    args
+		want    types.LogEntry
+		wantErr bool
 	}{
 		{
 			name: "types.System log entry",
 			args: args{
 				line:    "Oct 1 13:08:11 This is a log entry",
 				logType: types.System,
-				server:  "api",
+				source:  testSource,
 			},
 			want: types.LogEntry{
-				Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+				Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
 				Server:    "api",
-				Message:   "Oct 1 13:08:11 This is a log entry",
+				Message:   "This is a log entry",
 				Type:      types.System,
 			},
 		},
@@ -40,7 +57,7 @@ func Test_parseLogEntry(t *testing.T) {
 			args: args{
 				line:    "WrongTimestamp This is a log entry",
 				logType: types.System,
-				server:  "api",
+				source:  testSource,
 			},
 			want: types.LogEntry{
 				Timestamp: time.Time{},
@@ -48,16 +65,73 @@ func Test_parseLogEntry(t *testing.T) {
 				Message:   "",
 				Type:      "",
 			},
+			wantErr: true,
+		},
+		{
+			name: "types.System log entry from previous year",
+			args: args{
+				line:    "Dec 31 23:59:59 This is a log entry",
+				logType: types.System,
+				source:  testSource.withModTime(time.Date(2025, time.January, 1, 0, 0, 5, 0, time.UTC)),
+			},
+			want: types.LogEntry{
+				Timestamp: time.Date(2024, time.December, 31, 23, 59, 59, 0, time.UTC),
+				Server:    "api",
+				Message:   "This is a log entry",
+				Type:      types.System,
+			},
+		},
+		{
+			name: "types.System log entry on Feb 29",
+			args: args{
+				line:    "Feb 29 10:00:00 This is a log entry",
+				logType: types.System,
+				source:  testSource.withModTime(time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC)),
+			},
+			want: types.LogEntry{
+				Timestamp: time.Date(2024, time.February, 29, 10, 0, 0, 0, time.UTC),
+				Server:    "api",
+				Message:   "This is a log entry",
+				Type:      types.System,
+			},
+		},
+		{
+			name: "types.System log entry on Feb 29 written after it",
+			args: args{
+				line:    "Feb 29 10:00:00 This is a log entry",
+				logType: types.System,
+				source:  testSource.withModTime(time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC)),
+			},
+			want: types.LogEntry{
+				Timestamp: time.Date(2024, time.February, 29, 10, 0, 0, 0, time.UTC),
+				Server:    "api",
+				Message:   "This is a log entry",
+				Type:      types.System,
+			},
+		},
+		{
+			name: "types.System log entry in source time zone",
+			args: args{
+				line:    "Oct 1 13:08:11 This is a log entry",
+				logType: types.System,
+				source:  logSource{server: "api", location: time.FixedZone("PDT", -7*60*60), modTime: testSource.modTime},
+			},
+			want: types.LogEntry{
+				Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.FixedZone("PDT", -7*60*60)),
+				Server:    "api",
+				Message:   "This is a log entry",
+				Type:      types.System,
+			},
 		},
 		{
 			name: "types.Wifi log entry",
 			args: args{
 				line:    "Mon Sep 30 10:27:25.955 This is a log entry",
 				logType: types.Wifi,
-				server:  "api",
+				source:  testSource,
 			},
 			want: types.LogEntry{
-				Timestamp: time.Date(0, time.September, 30, 10, 27, 25, 955000000, time.UTC),
+				Timestamp: time.Date(2024, time.September, 30, 10, 27, 25, 955000000, time.UTC),
 				Server:    "api",
 				Message:   "Mon Sep 30 10:27:25.955 This is a log entry",
 				Type:      types.Wifi,
@@ -68,7 +142,7 @@ func Test_parseLogEntry(t *testing.T) {
 			args: args{
 				line:    "Mon blurp Sep 30 10:27:25.955 This is a log entry",
 				logType: types.Wifi,
-				server:  "api",
+				source:  testSource,
 			},
 			want: types.LogEntry{
 				Timestamp: time.Time{},
@@ -76,11 +150,18 @@ func Test_parseLogEntry(t *testing.T) {
 				Message:   "",
 				Type:      "",
 			},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := parseLogEntry(tt.args.line, tt.args.logType, tt.args.server); !reflect.DeepEqual(got, tt.want) {
+			logParser, _ := parser.Get(string(tt.args.logType))
+			got, err := parseLogEntry(tt.args.line, logParser, tt.args.source)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseLogEntry() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("parseLogEntry() = %v, want %v", got, tt.want)
 			}
 		})
@@ -91,7 +172,7 @@ func Test_readLastNLines(t *testing.T) {
 	type args struct {
 		fileBytes []byte
 		params    RequestParams
-		server    string
+		source    logSource
 	}
 	testLogReaderBytes := []byte(`Oct 1 13:08:07 This is a log entry
 	Oct 1 13:08:08 This is another log entry
@@ -109,13 +190,13 @@ func Test_readLastNLines(t *testing.T) {
 			args: args{
 				fileBytes: testLogReaderBytes,
 				params:    RequestParams{fileName: "system.log", lines: 1},
-				server:    "api",
+				source:    testSource,
 			},
 			want: []types.LogEntry{
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:11 This is a log entry",
+					Message:   "This is a log entry",
 					Type:      types.System,
 				},
 			},
@@ -126,37 +207,37 @@ func Test_readLastNLines(t *testing.T) {
 			args: args{
 				fileBytes: testLogReaderBytes,
 				params:    RequestParams{fileName: "system.log", lines: 5},
-				server:    "api",
+				source:    testSource,
 			},
 			want: []types.LogEntry{
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:11 This is a log entry",
+					Message:   "This is a log entry",
 					Type:      types.System,
 				},
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 10, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 10, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:10 This is another log entry",
+					Message:   "This is another log entry",
 					Type:      types.System,
 				},
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 9, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:09 This is a log entry",
+					Message:   "This is a log entry",
 					Type:      types.System,
 				},
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 8, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 8, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:08 This is another log entry",
+					Message:   "This is another log entry",
 					Type:      types.System,
 				},
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 7, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 7, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:07 This is a log entry",
+					Message:   "This is a log entry",
 					Type:      types.System,
 				},
 			},
@@ -167,37 +248,37 @@ func Test_readLastNLines(t *testing.T) {
 			args: args{
 				fileBytes: testLogReaderBytes,
 				params:    RequestParams{fileName: "system.log", lines: 15},
-				server:    "api",
+				source:    testSource,
 			},
 			want: []types.LogEntry{
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:11 This is a log entry",
+					Message:   "This is a log entry",
 					Type:      types.System,
 				},
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 10, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 10, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:10 This is another log entry",
+					Message:   "This is another log entry",
 					Type:      types.System,
 				},
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 9, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:09 This is a log entry",
+					Message:   "This is a log entry",
 					Type:      types.System,
 				},
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 8, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 8, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:08 This is another log entry",
+					Message:   "This is another log entry",
 					Type:      types.System,
 				},
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 7, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 7, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:07 This is a log entry",
+					Message:   "This is a log entry",
 					Type:      types.System,
 				},
 			},
@@ -207,14 +288,312 @@ func Test_readLastNLines(t *testing.T) {
 			name: "Read last 1 line with filter",
 			args: args{
 				fileBytes: testLogReaderBytes,
-				params:    RequestParams{fileName: "system.log", lines: 1, filter: "another"},
-				server:    "api",
+				params:    RequestParams{fileName: "system.log", lines: 1, filter: "another", query: mustParseQuery("another")},
+				source:    testSource,
 			},
 			want: []types.LogEntry{
 				{
-					Timestamp: time.Date(0, time.October, 1, 13, 8, 10, 0, time.UTC),
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 10, 0, time.UTC),
+					Server:    "api",
+					Message:   "This is another log entry",
+					Type:      types.System,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Read lines between since and until",
+			args: args{
+				fileBytes: testLogReaderBytes,
+				params: RequestParams{
+					fileName: "system.log",
+					lines:    10,
+					since:    time.Date(2024, time.October, 1, 13, 8, 8, 0, time.UTC),
+					until:    time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
+				},
+				source: testSource,
+			},
+			want: []types.LogEntry{
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
+					Server:    "api",
+					Message:   "This is a log entry",
+					Type:      types.System,
+				},
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 8, 0, time.UTC),
 					Server:    "api",
-					Message:   "Oct 1 13:08:10 This is another log entry",
+					Message:   "This is another log entry",
+					Type:      types.System,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Read lines since in an out of order file",
+			args: args{
+				fileBytes: []byte("Oct 1 10:05:00 newer\nOct 1 10:01:00 older\nOct 1 10:06:00 newest\n"),
+				params: RequestParams{
+					fileName: "system.log",
+					lines:    10,
+					since:    time.Date(2024, time.October, 1, 10, 3, 0, 0, time.UTC),
+				},
+				source: testSource,
+			},
+			want: []types.LogEntry{
+				{Timestamp: time.Date(2024, time.October, 1, 10, 6, 0, 0, time.UTC), Server: "api", Message: "newest", Type: types.System},
+				{Timestamp: time.Date(2024, time.October, 1, 10, 5, 0, 0, time.UTC), Server: "api", Message: "newer", Type: types.System},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Stop at since in a file known to be in order",
+			args: args{
+				// the index vouches for the order, so the start is not read
+				fileBytes: []byte("Oct 1 10:05:00 newer\nOct 1 10:01:00 older\nOct 1 10:06:00 newest\n"),
+				params: RequestParams{
+					fileName:    "system.log",
+					lines:       10,
+					since:       time.Date(2024, time.October, 1, 10, 3, 0, 0, time.UTC),
+					orderedUpTo: 64,
+				},
+				source: testSource,
+			},
+			want: []types.LogEntry{
+				{Timestamp: time.Date(2024, time.October, 1, 10, 6, 0, 0, time.UTC), Server: "api", Message: "newest", Type: types.System},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Continuation and unparseable lines",
+			args: args{
+				fileBytes: []byte("garbage before any entry\n" +
+					"Oct 1 13:08:07 host app[1]: request failed\n" +
+					"\tat main.handle(main.go:10)\n" +
+					"Caused by: timeout\n" +
+					"not a log line\n" +
+					"Oct 1 13:08:08 host app[1]: recovered\n"),
+				params: RequestParams{fileName: "system.log", lines: 4},
+				source: testSource,
+			},
+			want: []types.LogEntry{
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 8, 0, time.UTC),
+					Server:    "api",
+					Message:   "recovered",
+					Type:      types.System,
+					Hostname:  "host",
+					AppName:   "app",
+					ProcID:    "1",
+				},
+				{
+					Timestamp:  time.Date(2024, time.October, 1, 13, 8, 7, 0, time.UTC),
+					Server:     "api",
+					Message:    "not a log line",
+					Type:       types.System,
+					ParseError: true,
+				},
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 7, 0, time.UTC),
+					Server:    "api",
+					Message:   "request failed\n\tat main.handle(main.go:10)\nCaused by: timeout",
+					Type:      types.System,
+					Hostname:  "host",
+					AppName:   "app",
+					ProcID:    "1",
+				},
+				{
+					Server:     "api",
+					Message:    "garbage before any entry",
+					Type:       types.System,
+					ParseError: true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Continuation lines in out of order file",
+			args: args{
+				fileBytes: []byte("Oct 1 13:08:09 host app[1]: request failed\n" +
+					"    at main.handle(main.go:10)\n" +
+					"Oct 1 13:08:08 host app[1]: older\n"),
+				params: RequestParams{fileName: "system.log", lines: 2},
+				source: testSource,
+			},
+			want: []types.LogEntry{
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
+					Server:    "api",
+					Message:   "request failed\n    at main.handle(main.go:10)",
+					Type:      types.System,
+					Hostname:  "host",
+					AppName:   "app",
+					ProcID:    "1",
+				},
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 8, 0, time.UTC),
+					Server:    "api",
+					Message:   "older",
+					Type:      types.System,
+					Hostname:  "host",
+					AppName:   "app",
+					ProcID:    "1",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Read lines at or above a level",
+			args: args{
+				fileBytes: []byte("Oct 1 13:08:07 host app[1]: ERROR payment failed\n" +
+					"Oct 1 13:08:08 host app[1]: INFO retrying\n" +
+					"Oct 1 13:08:09 host app[1]: WARN slow response\n" +
+					"Oct 1 13:08:10 host app[1]: finished with no error\n"),
+				params: RequestParams{fileName: "system.log", lines: 10, level: "warn"},
+				source: testSource,
+			},
+			want: []types.LogEntry{
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
+					Server:    "api",
+					Message:   "WARN slow response",
+					Type:      types.System,
+					Hostname:  "host",
+					AppName:   "app",
+					ProcID:    "1",
+					Level:     "warn",
+				},
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 7, 0, time.UTC),
+					Server:    "api",
+					Message:   "ERROR payment failed",
+					Type:      types.System,
+					Hostname:  "host",
+					AppName:   "app",
+					ProcID:    "1",
+					Level:     "error",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Context around filter matches",
+			args: args{
+				fileBytes: testLogReaderBytes,
+				params:    RequestParams{fileName: "system.log", lines: 2, filter: "another", query: mustParseQuery("another"), before: 2, after: 1},
+				source:    testSource,
+			},
+			want: []types.LogEntry{
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 10, 0, time.UTC),
+					Server:    "api",
+					Message:   "This is another log entry",
+					Type:      types.System,
+					Before: []types.LogEntry{
+						{
+							Timestamp: time.Date(2024, time.October, 1, 13, 8, 8, 0, time.UTC),
+							Server:    "api",
+							Message:   "This is another log entry",
+							Type:      types.System,
+						},
+						{
+							Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
+							Server:    "api",
+							Message:   "This is a log entry",
+							Type:      types.System,
+						},
+					},
+					After: []types.LogEntry{
+						{
+							Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
+							Server:    "api",
+							Message:   "This is a log entry",
+							Type:      types.System,
+						},
+					},
+				},
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 8, 0, time.UTC),
+					Server:    "api",
+					Message:   "This is another log entry",
+					Type:      types.System,
+					Before: []types.LogEntry{
+						{
+							Timestamp: time.Date(2024, time.October, 1, 13, 8, 7, 0, time.UTC),
+							Server:    "api",
+							Message:   "This is a log entry",
+							Type:      types.System,
+						},
+					},
+					After: []types.LogEntry{
+						{
+							Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
+							Server:    "api",
+							Message:   "This is a log entry",
+							Type:      types.System,
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Context around match in out of order file",
+			args: args{
+				fileBytes: []byte(`Oct 1 13:08:07 This is a log entry
+Oct 1 13:08:11 This is the newest log entry
+Oct 1 13:08:09 This is a log entry
+Oct 1 13:08:08 This is another log entry`),
+				params: RequestParams{fileName: "system.log", lines: 1, filter: "newest", query: mustParseQuery("newest"), before: 1, after: 1},
+				source: testSource,
+			},
+			want: []types.LogEntry{
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
+					Server:    "api",
+					Message:   "This is the newest log entry",
+					Type:      types.System,
+					Before: []types.LogEntry{
+						{
+							Timestamp: time.Date(2024, time.October, 1, 13, 8, 7, 0, time.UTC),
+							Server:    "api",
+							Message:   "This is a log entry",
+							Type:      types.System,
+						},
+					},
+					After: []types.LogEntry{
+						{
+							Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
+							Server:    "api",
+							Message:   "This is a log entry",
+							Type:      types.System,
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Read last 2 lines from out of order file",
+			args: args{
+				fileBytes: []byte(`Oct 1 13:08:07 This is a log entry
+Oct 1 13:08:11 This is the newest log entry
+Oct 1 13:08:09 This is a log entry
+Oct 1 13:08:08 This is another log entry`),
+				params: RequestParams{fileName: "system.log", lines: 2},
+				source: testSource,
+			},
+			want: []types.LogEntry{
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
+					Server:    "api",
+					Message:   "This is the newest log entry",
+					Type:      types.System,
+				},
+				{
+					Timestamp: time.Date(2024, time.October, 1, 13, 8, 9, 0, time.UTC),
+					Server:    "api",
+					Message:   "This is a log entry",
 					Type:      types.System,
 				},
 			},
@@ -224,7 +603,7 @@ func Test_readLastNLines(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			file := bytes.NewReader(tt.args.fileBytes)
-			got, err := readLastNLines(file, tt.args.params, tt.args.server)
+			got, err := readLastNLines(file, tt.args.params, tt.args.source)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("readLastNLines() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -259,6 +638,7 @@ func Test_validateQueryParams(t *testing.T) {
 				fileName: "system.log",
 				lines:    5,
 				filter:   "error",
+				query:    mustParseQuery("error"),
 			},
 			wantErr: false,
 		},
@@ -286,6 +666,7 @@ func Test_validateQueryParams(t *testing.T) {
 				fileName: "system.log",
 				lines:    10,
 				filter:   "error",
+				query:    mustParseQuery("error"),
 			},
 			wantErr: false,
 		},
@@ -337,7 +718,8 @@ func Test_validateQueryParams(t *testing.T) {
 			want: RequestParams{
 				fileName: "system.log",
 				lines:    5,
-				filter:   "error",
+				filter:   "Error",
+				query:    mustParseQuery("Error"),
 			},
 			wantErr: false,
 		},
@@ -356,6 +738,221 @@ func Test_validateQueryParams(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "since and until are RFC3339",
+			args: args{
+				url: url.Values{
+					"since": []string{"2024-10-01T10:02:00Z"},
+					"until": []string{"2024-10-01T10:07:00Z"},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				since:    time.Date(2024, time.October, 1, 10, 2, 0, 0, time.UTC),
+				until:    time.Date(2024, time.October, 1, 10, 7, 0, 0, time.UTC),
+			},
+			wantErr: false,
+		},
+		{
+			name: "since is relative",
+			args: args{
+				url: url.Values{
+					"since": []string{"15m"},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				since:    time.Date(2024, time.October, 1, 9, 45, 0, 0, time.UTC),
+			},
+			wantErr: false,
+		},
+		{
+			name: "since is relative in days",
+			args: args{
+				url: url.Values{
+					"since": []string{"2d"},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				since:    time.Date(2024, time.September, 29, 10, 0, 0, 0, time.UTC),
+			},
+			wantErr: false,
+		},
+		{
+			name: "since is after until",
+			args: args{
+				url: url.Values{
+					"since": []string{"1h"},
+					"until": []string{"2h"},
+				},
+			},
+			want:    RequestParams{},
+			wantErr: true,
+		},
+		{
+			name: "until is not a time",
+			args: args{
+				url: url.Values{
+					"until": []string{"yesterday"},
+				},
+			},
+			want:    RequestParams{},
+			wantErr: true,
+		},
+		{
+			name: "filter is a query",
+			args: args{
+				url: url.Values{
+					"filter": []string{`server:api-2 AND (level:error OR /time(d )?out/) NOT "no error"`},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				filter:   `server:api-2 AND (level:error OR /time(d )?out/) NOT "no error"`,
+				query:    mustParseQuery(`server:api-2 AND (level:error OR /time(d )?out/) NOT "no error"`),
+			},
+			wantErr: false,
+		},
+		{
+			name: "filter has a syntax error",
+			args: args{
+				url: url.Values{
+					"filter": []string{"(error OR"},
+				},
+			},
+			want:    RequestParams{},
+			wantErr: true,
+		},
+		{
+			name: "follow is provided",
+			args: args{
+				url: url.Values{
+					"file":   []string{"system.log"},
+					"follow": []string{"true"},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				follow:   true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "follow is not a boolean",
+			args: args{
+				url: url.Values{
+					"follow": []string{"maybe"},
+				},
+			},
+			want:    RequestParams{},
+			wantErr: true,
+		},
+		{
+			name: "before and after are provided",
+			args: args{
+				url: url.Values{
+					"before": []string{"3"},
+					"after":  []string{"1"},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				before:   3,
+				after:    1,
+			},
+			wantErr: false,
+		},
+		{
+			name: "before is greater than 100",
+			args: args{
+				url: url.Values{
+					"before": []string{"101"},
+				},
+			},
+			want:    RequestParams{},
+			wantErr: true,
+		},
+		{
+			name: "level is provided",
+			args: args{
+				url: url.Values{
+					"level": []string{"WARNING"},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				level:    "warn",
+			},
+			wantErr: false,
+		},
+		{
+			name: "level is unknown",
+			args: args{
+				url: url.Values{
+					"level": []string{"loud"},
+				},
+			},
+			want:    RequestParams{},
+			wantErr: true,
+		},
+		{
+			name: "cursor is not valid",
+			args: args{
+				url: url.Values{
+					"cursor": []string{"not a cursor"},
+				},
+			},
+			want:    RequestParams{},
+			wantErr: true,
+		},
+		{
+			name: "partial without max_wait",
+			args: args{
+				url: url.Values{
+					"partial": []string{"true"},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				partial:  true,
+				maxWait:  time.Second,
+			},
+			wantErr: false,
+		},
+		{
+			name: "max_wait implies partial",
+			args: args{
+				url: url.Values{
+					"max_wait": []string{"250ms"},
+				},
+			},
+			want: RequestParams{
+				fileName: "system.log",
+				lines:    10,
+				partial:  true,
+				maxWait:  250 * time.Millisecond,
+			},
+			wantErr: false,
+		},
+		{
+			name: "max_wait is not a duration",
+			args: args{
+				url: url.Values{
+					"max_wait": []string{"soon"},
+				},
+			},
+			want:    RequestParams{},
+			wantErr: true,
+		},
 		{
 			name: "file is not provided, should default to system.log",
 			args: args{
@@ -368,10 +965,13 @@ func Test_validateQueryParams(t *testing.T) {
 				fileName: "system.log",
 				lines:    5,
 				filter:   "error",
+				query:    mustParseQuery("error"),
 			},
 			wantErr: false,
 		},
 	}
+	now = func() time.Time { return time.Date(2024, time.October, 1, 10, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := validateQueryParams(tt.args.url)
@@ -385,3 +985,58 @@ func Test_validateQueryParams(t *testing.T) {
 		})
 	}
 }
+
+func Test_newLogsResponse(t *testing.T) {
+	page := logPage{
+		logs: []types.LogEntry{
+			{Server: "api", Message: "not a log line", ParseError: true},
+		},
+		servers: []types.ServerStatus{
+			{Name: "api", Status: types.StatusOK, EntryCount: 1},
+			{Name: "api-2:4000", Status: types.StatusOK, Truncated: truncatedBytes},
+			{Name: "api-3:4000", Status: types.StatusError, Error: "connection refused"},
+		},
+	}
+	got := newLogsResponse(page)
+	want := types.LogsResponse{
+		Entries:         page.logs,
+		Servers:         page.servers,
+		Truncated:       true,
+		TruncatedReason: truncatedBytes,
+		Warnings: []string{
+			"no entries from api-3:4000: connection refused",
+			"api-2:4000 stopped reading at its max_bytes limit",
+			"lines that could not be parsed: 1",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newLogsResponse() = %+v, want %+v", got, want)
+	}
+
+	if got := newLogsResponse(logPage{}); got.Entries == nil || got.Truncated {
+		t.Errorf("newLogsResponse() for an empty page = %+v, want empty entries", got)
+	}
+}
+
+func Test_getUrlForPeer(t *testing.T) {
+	filter := `server:api-2 AND ("timed out" OR /a&b=c\/d/) NOT level:debug`
+	params, err := validateQueryParams(url.Values{"n": []string{"20"}, "file": []string{"wifi.log"}, "filter": []string{filter}, "before": []string{"2"}, "level": []string{"err"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peerUrl, err := url.Parse(getUrlForPeer("api-2:4000", params))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if peerUrl.Host != "api-2:4000" || peerUrl.Path != "/api/v1/logs" {
+		t.Errorf("getUrlForPeer() = %v, want host api-2:4000 and path /api/v1/logs", peerUrl)
+	}
+	got, err := validateQueryParams(peerUrl.Query())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, params) {
+		t.Errorf("peer params = %v, want %v", got, params)
+	}
+}
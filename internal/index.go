@@ -0,0 +1,325 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/parser"
+)
+
+const (
+	// defaultIndexInterval is how many lines lie between index points
+	defaultIndexInterval = 1024
+	// fingerprintSize is how much of the start of a file identifies it, a
+	// rotated file starts with different lines
+	fingerprintSize = 1024
+	// maxSyncIndexBytes is how much of a grown file a request indexes
+	// itself, larger parts are indexed in the background
+	maxSyncIndexBytes = 4 << 20
+	// indexPersistInterval is how often a growing index is saved
+	indexPersistInterval = time.Minute
+)
+
+// IndexStore keeps a sparse index from time to byte offset for every log
+// file queried with a time range, so reading can start right after the end
+// time instead of at the end of the file, and stop at the start time
+// knowing that the file is in order. Indexes are brought up to date
+// as files grow, rebuilt when a file is rotated and saved in dir, if set,
+// to survive restarts. A nil IndexStore indexes nothing.
+type IndexStore struct {
+	dir      string
+	interval int
+
+	mu    sync.Mutex
+	files map[string]*fileIndex
+}
+
+func NewIndexStore(dir string) *IndexStore {
+	return &IndexStore{dir: dir, interval: defaultIndexInterval, files: map[string]*fileIndex{}}
+}
+
+// fileIndex records the time and offset of an entry every interval
+// entries. It is only used while the file is in chronological order.
+type fileIndex struct {
+	mu       sync.Mutex
+	saved    time.Time
+	updating bool
+
+	// Size is how far the file is indexed, up to the end of a line
+	Size int64 `json:"size"`
+	// Fingerprint is a hash of the first FingerprintSize bytes
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int64  `json:"fingerprint_size"`
+	// Year and Zone are what years and zones were inferred from
+	Year int    `json:"year"`
+	Zone string `json:"zone"`
+	// Ordered is false once a line was found older than the one before
+	Ordered bool         `json:"ordered"`
+	Points  []indexPoint `json:"points"`
+	// Lines is the number of entries since the last point, Last the time
+	// of the last one indexed
+	Lines int       `json:"lines"`
+	Last  time.Time `json:"last"`
+}
+
+type indexPoint struct {
+	Offset int64     `json:"offset"`
+	Time   time.Time `json:"time"`
+}
+
+// seek returns an offset of file before which all entries at or before
+// until lie, or false if the index cannot tell.
+func (s *IndexStore) seek(path string, file *os.File, info os.FileInfo, p parser.Parser, source logSource, until time.Time) (int64, bool) {
+	var offset int64
+	var ok bool
+	s.use(path, file, info, p, source, func(index *fileIndex) {
+		offset, ok = index.seek(until)
+	})
+	return offset, ok
+}
+
+// ordered returns how many bytes from the start of file are known to hold
+// entries in chronological order, zero if the index cannot tell.
+func (s *IndexStore) ordered(path string, file *os.File, info os.FileInfo, p parser.Parser, source logSource) int64 {
+	var size int64
+	s.use(path, file, info, p, source, func(index *fileIndex) {
+		if index.Ordered {
+			size = index.Size
+		}
+	})
+	return size
+}
+
+// use brings the index of path up to date and calls f with it, unless it
+// is being built in the background.
+func (s *IndexStore) use(path string, file *os.File, info os.FileInfo, p parser.Parser, source logSource, f func(*fileIndex)) {
+	if s == nil {
+		return
+	}
+	index := s.index(path)
+	// a request does not wait for the index to be built in the background
+	if !index.mu.TryLock() {
+		return
+	}
+	defer index.mu.Unlock()
+	if index.updating {
+		return
+	}
+
+	if !index.valid(file, info, source) {
+		index.reset(source)
+	}
+	if info.Size()-index.Size > maxSyncIndexBytes {
+		index.updating = true
+		go s.update(path, index, p, source)
+		return
+	}
+	if err := index.extend(file, info.Size(), p, source, s.interval); err != nil {
+		log.Printf("indexing %s: %v", path, err)
+		return
+	}
+	s.save(path, index, false)
+	f(index)
+}
+
+// update indexes a large part of a file without holding up requests.
+func (s *IndexStore) update(path string, index *fileIndex, p parser.Parser, source logSource) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	defer func() { index.updating = false }()
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	if !index.valid(file, info, source) {
+		index.reset(source)
+	}
+	if err := index.extend(file, info.Size(), p, source, s.interval); err != nil {
+		log.Printf("indexing %s: %v", path, err)
+		return
+	}
+	s.save(path, index, true)
+}
+
+// index returns the index of path, loading it from dir the first time.
+func (s *IndexStore) index(path string) *fileIndex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index, ok := s.files[path]; ok {
+		return index
+	}
+	index := &fileIndex{}
+	if s.dir != "" {
+		if data, err := os.ReadFile(s.cachePath(path)); err == nil {
+			if err := json.Unmarshal(data, index); err != nil {
+				index = &fileIndex{}
+			} else {
+				index.saved = time.Now()
+			}
+		}
+	}
+	s.files[path] = index
+	return index
+}
+
+// save writes the index to dir, at most every indexPersistInterval unless
+// force is set.
+func (s *IndexStore) save(path string, index *fileIndex, force bool) {
+	if s.dir == "" || (!force && time.Since(index.saved) < indexPersistInterval) {
+		return
+	}
+	index.saved = time.Now()
+	data, err := json.Marshal(index)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		log.Printf("saving index of %s: %v", path, err)
+		return
+	}
+	// write and rename, so a crash does not leave half an index behind
+	tmp, err := os.CreateTemp(s.dir, "index-*.tmp")
+	if err != nil {
+		log.Printf("saving index of %s: %v", path, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.cachePath(path))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("saving index of %s: %v", path, err)
+	}
+}
+
+func (s *IndexStore) cachePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// valid reports whether the index still describes file: the file has not
+// shrunk or been replaced, and years and zones are inferred the same way.
+func (x *fileIndex) valid(file *os.File, info os.FileInfo, source logSource) bool {
+	if x.Fingerprint == "" || info.Size() < x.Size || info.Size() < x.FingerprintSize {
+		return false
+	}
+	year, zone := indexBasis(source)
+	if x.Year != year || x.Zone != zone {
+		return false
+	}
+	fingerprint, err := fingerprintOf(file, x.FingerprintSize)
+	return err == nil && fingerprint == x.Fingerprint
+}
+
+func (x *fileIndex) reset(source logSource) {
+	year, zone := indexBasis(source)
+	x.Size, x.Fingerprint, x.FingerprintSize = 0, "", 0
+	x.Year, x.Zone = year, zone
+	x.Ordered, x.Points, x.Lines, x.Last = true, nil, 0, time.Time{}
+}
+
+// extend indexes the lines between the indexed size and size.
+func (x *fileIndex) extend(file *os.File, size int64, p parser.Parser, source logSource, interval int) error {
+	if x.FingerprintSize < fingerprintSize && size > x.FingerprintSize {
+		length := min(size, fingerprintSize)
+		fingerprint, err := fingerprintOf(file, length)
+		if err != nil {
+			return err
+		}
+		x.Fingerprint, x.FingerprintSize = fingerprint, length
+	}
+	if !x.Ordered || size <= x.Size {
+		return nil
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(file, x.Size, size-x.Size))
+	offset := x.Size
+	for {
+		line, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// longer than the buffer, these lines are rare enough to read in full
+			rest, restErr := reader.ReadBytes('\n')
+			line, err = append(append([]byte(nil), line...), rest...), restErr
+		}
+		if err == io.EOF {
+			// a line still being written is indexed once it is complete
+			break
+		}
+		if err != nil {
+			return err
+		}
+		start := offset
+		offset += int64(len(line))
+		x.Size = offset
+		entry, parseErr := parseLogEntry(strings.TrimSuffix(string(line[:len(line)-1]), "\r"), p, source)
+		if parseErr != nil {
+			continue
+		}
+		if entry.Timestamp.Before(x.Last) {
+			x.Ordered = false
+			x.Points = nil
+			return nil
+		}
+		x.Last = entry.Timestamp
+		if len(x.Points) == 0 || x.Lines >= interval {
+			x.Points = append(x.Points, indexPoint{Offset: start, Time: entry.Timestamp})
+			x.Lines = 0
+		}
+		x.Lines++
+	}
+	return nil
+}
+
+// seek returns the offset of the first point after until. All entries from
+// there on are newer, as the file is in order.
+func (x *fileIndex) seek(until time.Time) (int64, bool) {
+	if !x.Ordered {
+		return 0, false
+	}
+	i := sort.Search(len(x.Points), func(i int) bool {
+		return x.Points[i].Time.After(until)
+	})
+	if i == len(x.Points) {
+		return 0, false
+	}
+	return x.Points[i].Offset, true
+}
+
+// indexBasis returns the year and zone timestamps without them are read in.
+func indexBasis(source logSource) (int, string) {
+	location := source.location
+	if location == nil {
+		location = time.UTC
+	}
+	return source.modTime.In(location).Year(), location.String()
+}
+
+func fingerprintOf(file *os.File, length int64) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, 0, length)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
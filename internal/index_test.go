@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/parser"
+)
+
+// writeEntries appends entries at the given seconds past 13:00 to path and
+// returns the offset each one starts at.
+func writeEntries(t *testing.T, path string, seconds ...int) []int64 {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := info.Size()
+	var offsets []int64
+	for _, sec := range seconds {
+		line := fmt.Sprintf("Oct 1 13:%02d:%02d entry %d\n", sec/60, sec%60, sec)
+		if _, err := file.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, offset)
+		offset += int64(len(line))
+	}
+	return offsets
+}
+
+func seconds(from, to int) []int {
+	var s []int
+	for i := from; i < to; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+func Test_IndexStore_seek(t *testing.T) {
+	at := func(sec int) time.Time {
+		return time.Date(2024, time.October, 1, 13, 0, sec, 0, time.UTC)
+	}
+	modTime := time.Date(2024, time.October, 2, 0, 0, 0, 0, time.UTC)
+	source := logSource{server: "api", location: time.UTC}
+
+	seek := func(store *IndexStore, path string, until time.Time) (int64, bool) {
+		t.Helper()
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store.seek(path, file, info, parser.ForFile("system.log"), source.withModTime(info.ModTime()), until)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "system.log")
+	cache := filepath.Join(dir, "cache")
+	store := NewIndexStore(cache)
+	store.interval = 10
+
+	offsets := writeEntries(t, path, seconds(0, 100)...)
+	if got, ok := seek(store, path, at(45)); !ok || got != offsets[50] {
+		t.Errorf("seek() = %v, %v, want %v, true", got, ok, offsets[50])
+	}
+	if _, ok := seek(store, path, at(95)); ok {
+		t.Errorf("seek() past the last point found an offset")
+	}
+
+	// growing files are indexed where they left off
+	points := append([]indexPoint(nil), store.index(path).Points...)
+	offsets = append(offsets, writeEntries(t, path, seconds(100, 130)...)...)
+	if got, ok := seek(store, path, at(105)); !ok || got != offsets[110] {
+		t.Errorf("seek() after appending = %v, %v, want %v, true", got, ok, offsets[110])
+	}
+	if index := store.index(path); len(index.Points) != 13 || !reflect.DeepEqual(index.Points[:len(points)], points) {
+		t.Errorf("index after appending has points %v, want the earlier %v and three more", index.Points, points)
+	}
+
+	// a new store picks the index up from the cache directory, as saved
+	// before it grew, which is saved at most once a minute
+	restarted := NewIndexStore(cache)
+	restarted.interval = 10
+	if index := restarted.index(path); index.Size != offsets[100] || len(index.Points) != 10 {
+		t.Errorf("loaded index = size %d, %d points, want size %d, 10 points", index.Size, len(index.Points), offsets[100])
+	}
+
+	// a rotated file starts over
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	offsets = writeEntries(t, path, seconds(200, 230)...)
+	if got, ok := seek(store, path, at(215)); !ok || got != offsets[20] {
+		t.Errorf("seek() after rotation = %v, %v, want %v, true", got, ok, offsets[20])
+	}
+
+	// out of order files are not indexed
+	unordered := filepath.Join(dir, "unordered.log")
+	writeEntries(t, unordered, append(seconds(0, 50), 10)...)
+	if _, ok := seek(store, unordered, at(5)); ok {
+		t.Errorf("seek() in an out of order file found an offset")
+	}
+}
+
+func Test_readLastNLinesRotated_index(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "system.log")
+	writeEntries(t, path, seconds(0, 3000)...)
+	modTime := time.Date(2024, time.October, 2, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Date(2024, time.October, 1, 13, 10, 0, 0, time.UTC)
+	params := RequestParams{fileName: "system.log", lines: 3, until: until}
+	source := logSource{server: "api", location: time.UTC}
+	messages := func(params RequestParams) string {
+		logs, err := readLastNLinesRotated(path, params, source)
+		if err != nil {
+			t.Fatalf("readLastNLinesRotated() error = %v", err)
+		}
+		var got []string
+		for _, entry := range logs {
+			got = append(got, entry.Message)
+		}
+		return strings.Join(got, ", ")
+	}
+
+	want := messages(params)
+	if want != "entry 600, entry 599, entry 598" {
+		t.Fatalf("readLastNLinesRotated() without an index = %q", want)
+	}
+	params.index = NewIndexStore("")
+	params.index.interval = 100
+	for i := 0; i < 2; i++ {
+		if got := messages(params); got != want {
+			t.Errorf("readLastNLinesRotated() with an index = %q, want %q", got, want)
+		}
+	}
+	// only the lines before the first point after until are read
+	params.budget = &queryBudget{maxBytes: 150 * 30}
+	if got := messages(params); got != want {
+		t.Errorf("readLastNLinesRotated() with an index = %q, want %q within %d bytes", got, want, params.budget.maxBytes)
+	}
+}
+
+func Test_IndexStore_ordered(t *testing.T) {
+	modTime := time.Date(2024, time.October, 2, 0, 0, 0, 0, time.UTC)
+	source := logSource{server: "api", location: time.UTC}
+	ordered := func(path string) int64 {
+		t.Helper()
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewIndexStore("").ordered(path, file, info, parser.ForFile("system.log"), source.withModTime(info.ModTime()))
+	}
+
+	dir := t.TempDir()
+	inOrder := filepath.Join(dir, "in-order.log")
+	writeEntries(t, inOrder, 1, 2, 3)
+	info, err := os.Stat(inOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ordered(inOrder); got != info.Size() {
+		t.Errorf("ordered() = %d, want %d", got, info.Size())
+	}
+
+	outOfOrder := filepath.Join(dir, "out-of-order.log")
+	writeEntries(t, outOfOrder, 5, 1, 6)
+	if got := ordered(outOfOrder); got != 0 {
+		t.Errorf("ordered() for a file out of order = %d, want 0", got)
+	}
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/config"
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// Reasons a query stopped before reading everything it was asked to
+const (
+	truncatedBytes   = "max_bytes"
+	truncatedEntries = "max_entries"
+	truncatedMemory  = "max_memory"
+	truncatedTime    = "max_time"
+)
+
+// truncatedHeader carries the reason in /api/v1/logs responses.
+const truncatedHeader = "X-Truncated"
+
+var errScanQueueFull = errors.New("too many queries, try again later")
+
+// deadlineCheckInterval is how many lines are read between looking at the
+// clock.
+const deadlineCheckInterval = 1024
+
+// queryBudget bounds the work a request does on this server: the bytes of
+// log files it scans, the entries it holds in memory at once, counted and
+// by the bytes of their messages, and the time it takes. Readers stop once
+// it is spent and return the newest entries they have, if they have read
+// the newest, and reason says which limit tripped. Zero limits are not
+// enforced, and a nil queryBudget never runs out.
+type queryBudget struct {
+	maxBytes   int64
+	maxEntries int
+	maxMemory  int64
+	deadline   time.Time
+
+	scanned int64
+	lines   int
+	reason  string
+}
+
+func newQueryBudget(c *config.Config, start time.Time) *queryBudget {
+	budget := &queryBudget{maxBytes: c.QueryMaxBytes, maxEntries: c.QueryMaxEntries, maxMemory: c.QueryMaxMemory}
+	if c.QueryMaxTime > 0 {
+		budget.deadline = start.Add(c.QueryMaxTime)
+	}
+	return budget
+}
+
+// scan accounts for a line of n bytes and reports whether reading may go on.
+func (b *queryBudget) scan(n int) bool {
+	if b == nil {
+		return true
+	}
+	if b.reason != "" {
+		return false
+	}
+	b.scanned += int64(n)
+	if b.maxBytes > 0 && b.scanned > b.maxBytes {
+		b.reason = truncatedBytes
+		return false
+	}
+	b.lines++
+	if !b.deadline.IsZero() && b.lines%deadlineCheckInterval == 0 && time.Now().After(b.deadline) {
+		b.reason = truncatedTime
+		return false
+	}
+	return true
+}
+
+// hold reports whether n entries of size bytes may be held in memory.
+func (b *queryBudget) hold(n, size int) bool {
+	if b == nil {
+		return true
+	}
+	if b.reason != "" {
+		return false
+	}
+	if b.maxEntries > 0 && n > b.maxEntries {
+		b.reason = truncatedEntries
+		return false
+	}
+	if b.maxMemory > 0 && int64(size) > b.maxMemory {
+		b.reason = truncatedMemory
+		return false
+	}
+	return true
+}
+
+// entrySize is roughly how many bytes entry takes in memory, its message
+// and that of its context, which hold most of the lines they were read
+// from.
+func entrySize(entry types.LogEntry) int {
+	size := len(entry.Message)
+	for _, context := range entry.Before {
+		size += len(context.Message)
+	}
+	for _, context := range entry.After {
+		size += len(context.Message)
+	}
+	return size
+}
+
+func entriesSize(entries []types.LogEntry) int {
+	size := 0
+	for _, entry := range entries {
+		size += entrySize(entry)
+	}
+	return size
+}
+
+// spent reports whether a limit has tripped.
+func (b *queryBudget) spent() bool {
+	return b != nil && b.reason != ""
+}
+
+// truncated returns the limit that tripped, or "".
+func (b *queryBudget) truncated() string {
+	if b == nil {
+		return ""
+	}
+	return b.reason
+}
+
+// ScanLimiter bounds how many requests scan log files at once, so that
+// concurrent queries cannot take all of the memory and disk bandwidth
+// between them. A nil ScanLimiter does not limit anything.
+type ScanLimiter struct {
+	slots chan struct{}
+}
+
+func NewScanLimiter(n int) *ScanLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &ScanLimiter{slots: make(chan struct{}, n)}
+}
+
+// acquire waits for a slot until ctx is done.
+func (l *ScanLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *ScanLimiter) release() {
+	if l != nil {
+		<-l.slots
+	}
+}
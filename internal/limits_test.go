@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+func Test_readLastNLines_budget(t *testing.T) {
+	var ordered, shuffled strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&ordered, "Oct 1 13:%02d:00 entry %d\n", i/60, i)
+	}
+	// out of order, so the whole file is scanned front to back
+	for i := 99; i >= 0; i-- {
+		fmt.Fprintf(&shuffled, "Oct 1 13:%02d:00 entry %d\n", (i*7%100)/60, i*7%100)
+	}
+	garbage := strings.Repeat("no timestamp here\n", 100)
+
+	tests := []struct {
+		name       string
+		file       string
+		budget     *queryBudget
+		lines      int
+		wantCount  int
+		wantReason string
+	}{
+		{
+			name:      "Within the limits",
+			file:      ordered.String(),
+			budget:    &queryBudget{maxBytes: 1 << 20, maxEntries: 1000},
+			lines:     10,
+			wantCount: 10,
+		},
+		{
+			name:       "Bytes scanned backwards",
+			file:       ordered.String(),
+			budget:     &queryBudget{maxBytes: 5 * 24},
+			lines:      10,
+			wantCount:  5,
+			wantReason: truncatedBytes,
+		},
+		{
+			name:   "Bytes scanned front to back",
+			file:   shuffled.String(),
+			budget: &queryBudget{maxBytes: 1000},
+			lines:  100,
+			// the newest entries were not read, so none are returned
+			wantCount:  0,
+			wantReason: truncatedBytes,
+		},
+		{
+			name:       "Memory held backwards",
+			file:       ordered.String(),
+			budget:     &queryBudget{maxMemory: 5*8 - 1},
+			lines:      10,
+			wantCount:  5,
+			wantReason: truncatedMemory,
+		},
+		{
+			name:       "Memory held front to back",
+			file:       shuffled.String(),
+			budget:     &queryBudget{maxMemory: 200},
+			lines:      100,
+			wantCount:  0,
+			wantReason: truncatedMemory,
+		},
+		{
+			name:       "Lines that do not parse are held",
+			file:       garbage,
+			budget:     &queryBudget{maxEntries: 10},
+			lines:      10,
+			wantCount:  10,
+			wantReason: truncatedEntries,
+		},
+		{
+			name:       "Time",
+			file:       ordered.String(),
+			budget:     &queryBudget{deadline: time.Now().Add(-time.Second), lines: deadlineCheckInterval - 1},
+			lines:      10,
+			wantCount:  0,
+			wantReason: truncatedTime,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := RequestParams{fileName: "system.log", lines: tt.lines, budget: tt.budget}
+			got, err := readLastNLines(bytes.NewReader([]byte(tt.file)), params, testSource)
+			if err != nil {
+				t.Fatalf("readLastNLines() error = %v", err)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("readLastNLines() returned %d entries, want %d", len(got), tt.wantCount)
+			}
+			if reason := tt.budget.truncated(); reason != tt.wantReason {
+				t.Errorf("truncated() = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func Test_newestMatches(t *testing.T) {
+	base := time.Date(2024, time.October, 1, 13, 0, 0, 0, time.UTC)
+	params := RequestParams{lines: 5, before: 1}
+	matches := newNewestMatches(params)
+	for i := 0; i < 1000; i++ {
+		// every hundredth entry is newer than all the others
+		timestamp := base.Add(time.Duration(i) * time.Second)
+		if i%100 == 0 {
+			timestamp = base.Add(time.Hour + time.Duration(i)*time.Second)
+		}
+		matches.add(types.LogEntry{Timestamp: timestamp, Server: "api", Message: fmt.Sprintf("entry %d", i)})
+		if len(matches.matches) >= 2*params.lines {
+			t.Fatalf("newestMatches holds %d matches, want fewer than %d", len(matches.matches), 2*params.lines)
+		}
+	}
+
+	var got []string
+	for _, entry := range matches.result() {
+		got = append(got, entry.Before[0].Message+", "+entry.Message)
+	}
+	want := []string{"entry 899, entry 900", "entry 799, entry 800", "entry 699, entry 700", "entry 599, entry 600", "entry 499, entry 500"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newestMatches.result() = %q, want %q", got, want)
+	}
+}
+
+func Test_ScanLimiter(t *testing.T) {
+	limiter := NewScanLimiter(1)
+	if err := limiter.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := limiter.acquire(ctx); err == nil {
+		t.Fatal("acquire() with every slot taken succeeded")
+	}
+	limiter.release()
+	if err := limiter.acquire(context.Background()); err != nil {
+		t.Errorf("acquire() after release error = %v", err)
+	}
+
+	var unlimited *ScanLimiter
+	if err := unlimited.acquire(ctx); err != nil {
+		t.Errorf("acquire() on a nil limiter error = %v", err)
+	}
+}
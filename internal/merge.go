@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"container/heap"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// entrySource yields entries newest first.
+type entrySource interface {
+	next() (types.LogEntry, bool)
+}
+
+// sliceSource yields entries that have already been read.
+type sliceSource []types.LogEntry
+
+func (s *sliceSource) next() (types.LogEntry, bool) {
+	if len(*s) == 0 {
+		return types.LogEntry{}, false
+	}
+	entry := (*s)[0]
+	*s = (*s)[1:]
+	return entry, true
+}
+
+// mergeNewest merges sources, each sorted newest first, into their n newest
+// entries. Only one entry per source is held at a time and no source is
+// read further than needed. Entries with the same time keep the order of
+// their sources, and entries that arrive more than once, from a server
+// reached through several peers, are returned once.
+func mergeNewest(sources []entrySource, n int) []types.LogEntry {
+	heads := make(entryHeap, 0, len(sources))
+	for i, source := range sources {
+		if entry, ok := source.next(); ok {
+			heads = append(heads, head{entry: entry, source: i})
+		}
+	}
+	heap.Init(&heads)
+
+	seen := map[entryKey]bool{}
+	var logs []types.LogEntry
+	for len(heads) > 0 && len(logs) < n {
+		top := &heads[0]
+		if key := keyOf(top.entry); !seen[key] {
+			seen[key] = true
+			logs = append(logs, top.entry)
+		}
+		if len(logs) == n {
+			break
+		}
+		if entry, ok := sources[top.source].next(); ok {
+			top.entry = entry
+			heap.Fix(&heads, 0)
+		} else {
+			heap.Pop(&heads)
+		}
+	}
+	return logs
+}
+
+// entryKey identifies an entry by where it was read, or by its time and
+// message for entries without a position. Server names are often left at
+// their default, so the file is told apart by its identity as well.
+type entryKey struct {
+	server  string
+	file    string
+	fileID  string
+	offset  int64
+	time    int64
+	message string
+}
+
+func keyOf(entry types.LogEntry) entryKey {
+	key := entryKey{server: entry.Server}
+	if entry.Position != nil {
+		key.file, key.fileID, key.offset = entry.Position.File, entry.Position.FileID, entry.Position.Offset
+	} else {
+		key.time, key.message = entry.Timestamp.UnixNano(), entry.Message
+	}
+	return key
+}
+
+type head struct {
+	entry  types.LogEntry
+	source int
+}
+
+// entryHeap keeps the newest entry on top.
+type entryHeap []head
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].entry.Timestamp.Equal(h[j].entry.Timestamp) {
+		return h[i].source < h[j].source
+	}
+	return h[i].entry.Timestamp.After(h[j].entry.Timestamp)
+}
+
+func (h entryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *entryHeap) Push(x any) { *h = append(*h, x.(head)) }
+
+func (h *entryHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// countingSource counts how many entries were read from it.
+type countingSource struct {
+	sliceSource
+	read int
+}
+
+func (s *countingSource) next() (types.LogEntry, bool) {
+	entry, ok := s.sliceSource.next()
+	if ok {
+		s.read++
+	}
+	return entry, ok
+}
+
+func Test_mergeNewest(t *testing.T) {
+	at := func(sec int) time.Time {
+		return time.Date(2024, time.October, 1, 13, 8, sec, 0, time.UTC)
+	}
+	entry := func(server string, sec int, offset int64) types.LogEntry {
+		return types.LogEntry{Timestamp: at(sec), Server: server, Position: &types.Position{File: "system.log", Offset: offset}}
+	}
+
+	tests := []struct {
+		name    string
+		sources [][]types.LogEntry
+		n       int
+		want    []types.LogEntry
+		// entries read from each source
+		wantRead []int
+	}{
+		{
+			name: "Interleaved sources",
+			sources: [][]types.LogEntry{
+				{entry("api", 9, 30), entry("api", 5, 20), entry("api", 1, 10)},
+				{entry("api-2", 8, 30), entry("api-2", 7, 20)},
+			},
+			n:        10,
+			want:     []types.LogEntry{entry("api", 9, 30), entry("api-2", 8, 30), entry("api-2", 7, 20), entry("api", 5, 20), entry("api", 1, 10)},
+			wantRead: []int{3, 2},
+		},
+		{
+			name: "Stops after n",
+			sources: [][]types.LogEntry{
+				{entry("api", 9, 30), entry("api", 5, 20), entry("api", 1, 10)},
+				{entry("api-2", 8, 30), entry("api-2", 7, 20), entry("api-2", 6, 10)},
+			},
+			n:        2,
+			want:     []types.LogEntry{entry("api", 9, 30), entry("api-2", 8, 30)},
+			wantRead: []int{2, 1},
+		},
+		{
+			name: "Same time keeps the order of sources",
+			sources: [][]types.LogEntry{
+				{entry("api", 5, 20), entry("api", 5, 10)},
+				{entry("api-2", 5, 10)},
+			},
+			n:        10,
+			want:     []types.LogEntry{entry("api", 5, 20), entry("api", 5, 10), entry("api-2", 5, 10)},
+			wantRead: []int{2, 1},
+		},
+		{
+			name: "Server reached through two peers",
+			sources: [][]types.LogEntry{
+				{entry("api", 9, 30)},
+				{entry("api-3", 8, 30), entry("api-3", 7, 20)},
+				{entry("api-3", 8, 30), entry("api-3", 7, 20)},
+			},
+			n:        10,
+			want:     []types.LogEntry{entry("api", 9, 30), entry("api-3", 8, 30), entry("api-3", 7, 20)},
+			wantRead: []int{1, 2, 2},
+		},
+		{
+			name: "Servers sharing a name",
+			sources: [][]types.LogEntry{
+				{{Timestamp: at(5), Server: "api", Position: &types.Position{File: "system.log", Offset: 10, FileID: "23-aa"}}},
+				{{Timestamp: at(5), Server: "api", Position: &types.Position{File: "system.log", Offset: 10, FileID: "23-bb"}}},
+			},
+			n: 10,
+			want: []types.LogEntry{
+				{Timestamp: at(5), Server: "api", Position: &types.Position{File: "system.log", Offset: 10, FileID: "23-aa"}},
+				{Timestamp: at(5), Server: "api", Position: &types.Position{File: "system.log", Offset: 10, FileID: "23-bb"}},
+			},
+			wantRead: []int{1, 1},
+		},
+		{
+			name: "Entries without a position",
+			sources: [][]types.LogEntry{
+				{{Timestamp: at(5), Server: "api-3", Message: "a"}},
+				{{Timestamp: at(5), Server: "api-3", Message: "a"}, {Timestamp: at(5), Server: "api-3", Message: "b"}},
+			},
+			n:        10,
+			want:     []types.LogEntry{{Timestamp: at(5), Server: "api-3", Message: "a"}, {Timestamp: at(5), Server: "api-3", Message: "b"}},
+			wantRead: []int{1, 2},
+		},
+		{
+			name:     "No entries",
+			sources:  [][]types.LogEntry{nil, nil},
+			n:        10,
+			want:     nil,
+			wantRead: []int{0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counting := make([]*countingSource, len(tt.sources))
+			sources := make([]entrySource, len(tt.sources))
+			for i, entries := range tt.sources {
+				counting[i] = &countingSource{sliceSource: entries}
+				sources[i] = counting[i]
+			}
+			if got := mergeNewest(sources, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeNewest() = %v, want %v", got, tt.want)
+			}
+			for i, source := range counting {
+				if source.read != tt.wantRead[i] {
+					t.Errorf("mergeNewest() read %d entries from source %d, want %d", source.read, i, tt.wantRead[i])
+				}
+			}
+		})
+	}
+}
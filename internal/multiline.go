@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bipinshashi/log-collection/internal/parser"
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// continuationLine matches lines that carry on the entry before them, such
+// as indented stack frames and wrapped messages.
+var continuationLine = regexp.MustCompile(`^(\s|Caused by:|Traceback |\.\.\. \d+ more)`)
+
+// rawLine is a line of a file and the offset it starts at.
+type rawLine struct {
+	text   string
+	offset int64
+}
+
+// assembleRecord builds the records for an entry and the unparseable lines
+// that follow it in the file, in file order. Continuation lines are
+// appended to the entry's message, any other line becomes a record of its
+// own flagged with ParseError. Those records take the timestamp of the
+// entry so they stay next to it. An entry with a zero timestamp stands for
+// lines at the start of a file that follow no entry.
+func assembleRecord(entry *types.LogEntry, following []rawLine, p parser.Parser, source logSource) []types.LogEntry {
+	var continuation []string
+	var errors []types.LogEntry
+	for _, line := range following {
+		if strings.TrimSpace(line.text) == "" {
+			continue
+		}
+		if entry != nil && continuationLine.MatchString(line.text) {
+			continuation = append(continuation, line.text)
+			continue
+		}
+		parseError := types.LogEntry{
+			Server:     source.server,
+			Message:    line.text,
+			Type:       types.LogEntryType(p.Name()),
+			ParseError: true,
+			Position:   source.position(line.offset),
+		}
+		if entry != nil {
+			parseError.Timestamp = entry.Timestamp
+		}
+		errors = append(errors, parseError)
+	}
+
+	if entry == nil {
+		return errors
+	}
+	record := *entry
+	if len(continuation) > 0 {
+		record.Message = strings.Join(append([]string{record.Message}, continuation...), "\n")
+	}
+	return append([]types.LogEntry{record}, errors...)
+}
+
+// lineGrouper groups lines read front to back into records.
+type lineGrouper struct {
+	parser    parser.Parser
+	source    logSource
+	entry     *types.LogEntry
+	following []rawLine
+}
+
+func newLineGrouper(p parser.Parser, source logSource) *lineGrouper {
+	return &lineGrouper{parser: p, source: source}
+}
+
+// add consumes the next line, which starts at offset, and returns the
+// records it completed.
+func (g *lineGrouper) add(line string, offset int64) []types.LogEntry {
+	entry, err := parseLogEntry(line, g.parser, g.source)
+	if err != nil {
+		g.following = append(g.following, rawLine{text: line, offset: offset})
+		return nil
+	}
+	entry.Position = g.source.position(offset)
+	records := g.flush()
+	g.entry = &entry
+	return records
+}
+
+// pending returns how many lines are held back and their size.
+func (g *lineGrouper) pending() (int, int) {
+	size := 0
+	if g.entry != nil {
+		size = len(g.entry.Message)
+	}
+	return len(g.following) + 1, size + linesSize(g.following)
+}
+
+func linesSize(lines []rawLine) int {
+	size := 0
+	for _, line := range lines {
+		size += len(line.text)
+	}
+	return size
+}
+
+// flush returns the records still held back.
+func (g *lineGrouper) flush() []types.LogEntry {
+	records := assembleRecord(g.entry, g.following, g.parser, g.source)
+	g.entry, g.following = nil, nil
+	return records
+}
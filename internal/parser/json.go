@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+var errNotJSONObject = errors.New("line is not a JSON object")
+
+// JSONKeys lists the keys a JSONParser looks up, in order of preference.
+type JSONKeys struct {
+	Timestamp []string
+	Level     []string
+	Message   []string
+}
+
+var DefaultJSONKeys = JSONKeys{
+	Timestamp: []string{"time", "timestamp", "ts", "@timestamp"},
+	Level:     []string{"level", "severity", "lvl"},
+	Message:   []string{"msg", "message"},
+}
+
+// JSONParser parses lines holding one JSON object each. The timestamp,
+// level and message are taken from the configured keys and every other key
+// is kept in the entry's Fields.
+type JSONParser struct {
+	name string
+	keys JSONKeys
+}
+
+func NewJSONParser(name string, keys JSONKeys) *JSONParser {
+	return &JSONParser{name: name, keys: keys}
+}
+
+func (p *JSONParser) Name() string {
+	return p.name
+}
+
+func (p *JSONParser) Parse(line string) (types.LogEntry, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		return types.LogEntry{}, errNotJSONObject
+	}
+	decoder := json.NewDecoder(strings.NewReader(line))
+	// keep numbers as written so they are passed on unchanged
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return types.LogEntry{}, errNotJSONObject
+	}
+
+	key, value, ok := lookup(fields, p.keys.Timestamp)
+	if !ok {
+		return types.LogEntry{}, ErrNoTimestamp
+	}
+	timestamp, ok := parseJSONTime(value)
+	if !ok {
+		return types.LogEntry{}, ErrNoTimestamp
+	}
+	delete(fields, key)
+
+	entry := types.LogEntry{
+		Timestamp: timestamp,
+		Type:      types.LogEntryType(p.name),
+	}
+	if key, value, ok := lookup(fields, p.keys.Message); ok {
+		if message, ok := value.(string); ok {
+			entry.Message = message
+			delete(fields, key)
+		}
+	}
+	if key, value, ok := lookup(fields, p.keys.Level); ok {
+		if level, ok := value.(string); ok {
+			entry.Severity = level
+			entry.Level, _ = NormalizeLevel(level)
+			delete(fields, key)
+		}
+	}
+	if entry.Level == "" {
+		entry.Level = levelFromMessage(entry.Message)
+	}
+	if len(fields) > 0 {
+		entry.Fields = fields
+	}
+	return entry, nil
+}
+
+// lookup returns the first of keys present in fields.
+func lookup(fields map[string]any, keys []string) (string, any, bool) {
+	for _, key := range keys {
+		if value, ok := fields[key]; ok {
+			return key, value, true
+		}
+	}
+	return "", nil, false
+}
+
+// parseJSONTime accepts RFC 3339 strings and Unix times in seconds or, for
+// values too large to be seconds, milliseconds.
+func parseJSONTime(value any) (time.Time, bool) {
+	switch v := value.(type) {
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		if math.Abs(f) >= 1e12 {
+			return time.UnixMilli(int64(f)).UTC(), true
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+	}
+	return time.Time{}, false
+}
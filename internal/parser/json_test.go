@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+func TestJSONParser_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    JSONKeys
+		line    string
+		want    types.LogEntry
+		wantErr bool
+	}{
+		{
+			name: "Default keys",
+			keys: DefaultJSONKeys,
+			line: `{"time":"2024-10-01T13:08:11.5Z","level":"error","msg":"payment failed","order_id":9007199254740993,"retry":true}`,
+			want: types.LogEntry{
+				Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 500000000, time.UTC),
+				Message:   "payment failed",
+				Type:      "json",
+				Severity:  "error",
+				Level:     "error",
+				Fields: map[string]any{
+					"order_id": json.Number("9007199254740993"),
+					"retry":    true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Custom keys and Unix milliseconds",
+			keys: JSONKeys{Timestamp: []string{"at"}, Level: []string{"lvl"}, Message: []string{"text"}},
+			line: `{"at":1727788091000,"lvl":"info","text":"started","msg":"not the message"}`,
+			want: types.LogEntry{
+				Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 0, time.UTC),
+				Message:   "started",
+				Type:      "json",
+				Severity:  "info",
+				Level:     "info",
+				Fields:    map[string]any{"msg": "not the message"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Unix seconds with fraction",
+			keys: DefaultJSONKeys,
+			line: `{"ts":1727788091.25,"message":"started"}`,
+			want: types.LogEntry{
+				Timestamp: time.Date(2024, time.October, 1, 13, 8, 11, 250000000, time.UTC),
+				Message:   "started",
+				Type:      "json",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "Missing timestamp",
+			keys:    DefaultJSONKeys,
+			line:    `{"msg":"no time"}`,
+			want:    types.LogEntry{},
+			wantErr: true,
+		},
+		{
+			name:    "Not JSON",
+			keys:    DefaultJSONKeys,
+			line:    "Oct 1 13:08:11 This is a log entry",
+			want:    types.LogEntry{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewJSONParser("json", tt.keys).Parse(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
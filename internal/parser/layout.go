@@ -0,0 +1,43 @@
+package parser
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// LayoutParser parses lines that start with a timestamp in a fixed layout
+// made up of a known number of space separated fields. The whole line is
+// kept as the message.
+type LayoutParser struct {
+	name   string
+	layout string
+	part   int
+}
+
+func NewLayoutParser(name, layout string, part int) *LayoutParser {
+	return &LayoutParser{name: name, layout: layout, part: part}
+}
+
+func (p *LayoutParser) Name() string {
+	return p.name
+}
+
+func (p *LayoutParser) Parse(line string) (types.LogEntry, error) {
+	parts := strings.Fields(line)
+	if len(parts) < p.part {
+		return types.LogEntry{}, ErrNoTimestamp
+	}
+	timestamp, err := time.Parse(p.layout, strings.Join(parts[0:p.part], " "))
+	if err != nil {
+		return types.LogEntry{}, ErrNoTimestamp
+	}
+	message := strings.Join(parts, " ")
+	return types.LogEntry{
+		Timestamp: timestamp,
+		Message:   message,
+		Type:      types.LogEntryType(p.name),
+		Level:     levelFromMessage(message),
+	}, nil
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Levels lists the normalised entry levels from least to most severe.
+var Levels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// levelNames maps the level names used by syslog and common logging
+// libraries to the normalised levels.
+var levelNames = map[string]string{
+	"trace":    "trace",
+	"debug":    "debug",
+	"info":     "info",
+	"notice":   "info",
+	"warn":     "warn",
+	"warning":  "warn",
+	"err":      "error",
+	"error":    "error",
+	"crit":     "fatal",
+	"critical": "fatal",
+	"alert":    "fatal",
+	"emerg":    "fatal",
+	"fatal":    "fatal",
+	"panic":    "fatal",
+}
+
+// levelKeyword matches upper case level keywords in a message, as written by
+// most loggers, so that "no error" is not taken for an error.
+var levelKeyword = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERR|ERROR|CRIT|CRITICAL|ALERT|EMERG|FATAL|PANIC)\b`)
+
+// NormalizeLevel returns the normalised level for a level name, ignoring
+// case, and false if the name is not known.
+func NormalizeLevel(name string) (string, bool) {
+	level, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]
+	return level, ok
+}
+
+// LevelAtLeast reports whether level is minimum or more severe. Entries
+// without a known level never are.
+func LevelAtLeast(level, minimum string) bool {
+	rank := levelRank(level)
+	return rank >= 0 && rank >= levelRank(minimum)
+}
+
+func levelRank(level string) int {
+	for i, l := range Levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// levelFromMessage returns the level of the first level keyword in message.
+func levelFromMessage(message string) string {
+	keyword := levelKeyword.FindString(message)
+	if keyword == "" {
+		return ""
+	}
+	level, _ := NormalizeLevel(keyword)
+	return level
+}
@@ -0,0 +1,44 @@
+package parser
+
+import "testing"
+
+func TestLevelAtLeast(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		minimum string
+		want    bool
+	}{
+		{name: "Same level", level: "warn", minimum: "warn", want: true},
+		{name: "More severe", level: "fatal", minimum: "warn", want: true},
+		{name: "Less severe", level: "info", minimum: "warn", want: false},
+		{name: "Unknown level", level: "", minimum: "trace", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LevelAtLeast(tt.level, tt.minimum); got != tt.want {
+				t.Errorf("LevelAtLeast() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_levelFromMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{name: "Keyword", message: "ERROR payment failed", want: "error"},
+		{name: "Bracketed keyword", message: "[WARNING] disk almost full", want: "warn"},
+		{name: "Lower case is not a keyword", message: "finished with no error", want: ""},
+		{name: "Keyword inside a word", message: "INFORMATION", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := levelFromMessage(tt.message); got != tt.want {
+				t.Errorf("levelFromMessage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
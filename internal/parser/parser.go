@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// DefaultParser is used for files no rule matches.
+const DefaultParser = "system"
+
+// Parser turns a single line of a log file into an entry.
+type Parser interface {
+	// Name identifies the parser in the registry and in rules. It is also
+	// used as the type of the entries it parses.
+	Name() string
+	// Parse parses line. The timestamp may leave out the year and time zone,
+	// those are filled in by the caller. The server is set by the caller.
+	Parse(line string) (types.LogEntry, error)
+}
+
+// ErrNoTimestamp is returned by parsers for lines that do not start with a
+// timestamp.
+var ErrNoTimestamp = errors.New("line has no timestamp")
+
+func init() {
+	wifi := types.LogEntryTypeTimePart[types.Wifi]
+	Register(NewLayoutParser(string(types.Wifi), wifi.Layout, wifi.Part))
+	Register(NewSyslogParser(string(types.System)))
+	Register(NewSyslogParser("syslog"))
+	Register(NewJSONParser("json", DefaultJSONKeys))
+	// the rules that used to be hard-coded in the handler
+	AddRule("*system*", string(types.System))
+	AddRule("*wifi*", string(types.Wifi))
+}
+
+type rule struct {
+	pattern string
+	parser  string
+}
+
+var (
+	mu      sync.RWMutex
+	parsers = map[string]Parser{}
+	rules   []rule
+)
+
+// Register adds p to the registry, replacing any parser with the same name.
+func Register(p Parser) {
+	mu.Lock()
+	defer mu.Unlock()
+	parsers[p.Name()] = p
+}
+
+// Get returns the parser registered under name.
+func Get(name string) (Parser, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := parsers[name]
+	return p, ok
+}
+
+// AddRule maps files whose name matches the glob pattern to the parser
+// registered under name. Rules added later take precedence.
+func AddRule(pattern, name string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := parsers[name]; !ok {
+		return fmt.Errorf("unknown parser %q", name)
+	}
+	rules = append([]rule{{pattern: pattern, parser: name}}, rules...)
+	return nil
+}
+
+// AddRules adds rules written as "pattern=parser" pairs separated by
+// commas, e.g. "app-*.log=json,*wifi*=wifi".
+func AddRules(spec string) error {
+	pairs := strings.Split(spec, ",")
+	// add in reverse so the first pair takes precedence
+	for i := len(pairs) - 1; i >= 0; i-- {
+		pair := strings.TrimSpace(pairs[i])
+		if pair == "" {
+			continue
+		}
+		pattern, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid parser rule %q", pair)
+		}
+		if err := AddRule(strings.TrimSpace(pattern), strings.TrimSpace(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForFile returns the parser for fileName. The pattern of each rule is
+// matched against the file name and its base name.
+func ForFile(fileName string) Parser {
+	mu.RLock()
+	defer mu.RUnlock()
+	base := path.Base(fileName)
+	for _, r := range rules {
+		if matched, _ := path.Match(r.pattern, fileName); matched {
+			return parsers[r.parser]
+		}
+		if matched, _ := path.Match(r.pattern, base); matched {
+			return parsers[r.parser]
+		}
+	}
+	return parsers[DefaultParser]
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+type testParser struct{}
+
+func (testParser) Name() string { return "test" }
+
+func (testParser) Parse(line string) (types.LogEntry, error) {
+	return types.LogEntry{Message: line, Type: "test"}, nil
+}
+
+// restoreRegistry puts back the registered parsers and rules once t is
+// done, so the ones t adds do not leak into later tests.
+func restoreRegistry(t *testing.T) {
+	mu.RLock()
+	savedParsers, savedRules := maps.Clone(parsers), slices.Clone(rules)
+	mu.RUnlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		parsers, rules = savedParsers, savedRules
+	})
+}
+
+func TestForFile(t *testing.T) {
+	restoreRegistry(t)
+	Register(testParser{})
+	if err := AddRules("app-*.log=test, nested/*.txt=test"); err != nil {
+		t.Fatalf("AddRules() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		fileName string
+		want     string
+	}{
+		{
+			name:     "Wifi file",
+			fileName: "wifi.log",
+			want:     "wifi",
+		},
+		{
+			name:     "System file",
+			fileName: "system.log",
+			want:     "system",
+		},
+		{
+			name:     "Unknown file falls back to default",
+			fileName: "kernel.log",
+			want:     DefaultParser,
+		},
+		{
+			name:     "Registered rule",
+			fileName: "app-payments.log",
+			want:     "test",
+		},
+		{
+			name:     "Rule matching base name",
+			fileName: "services/app-payments.log",
+			want:     "test",
+		},
+		{
+			name:     "Rule with directory",
+			fileName: "nested/output.txt",
+			want:     "test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ForFile(tt.fileName).Name(); got != tt.want {
+				t.Errorf("ForFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddRules(t *testing.T) {
+	restoreRegistry(t)
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr bool
+	}{
+		{
+			name:    "Empty spec",
+			spec:    "",
+			wantErr: false,
+		},
+		{
+			name:    "Unknown parser",
+			spec:    "*.log=nope",
+			wantErr: true,
+		},
+		{
+			name:    "Missing parser",
+			spec:    "*.log",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid pattern",
+			spec:    "[.log=system",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := AddRules(tt.spec); (err != nil) != tt.wantErr {
+				t.Errorf("AddRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLayoutParser_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		parser  *LayoutParser
+		line    string
+		want    types.LogEntry
+		wantErr bool
+	}{
+		{
+			name:   "Timestamp without year",
+			parser: NewLayoutParser("system", "Jan 2 15:04:05", 3),
+			line:   "Oct 1 13:08:11 This is a log entry",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+				Message:   "Oct 1 13:08:11 This is a log entry",
+				Type:      "system",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "Too few fields",
+			parser:  NewLayoutParser("system", "Jan 2 15:04:05", 3),
+			line:    "Oct 1",
+			want:    types.LogEntry{},
+			wantErr: true,
+		},
+		{
+			name:    "Wrong layout",
+			parser:  NewLayoutParser("wifi", "Mon Jan 2 15:04:05.000", 4),
+			line:    "Oct 1 13:08:11 This is a log entry",
+			want:    types.LogEntry{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parser.Parse(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package parser
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+const nilValue = "-"
+
+var facilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var severities = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+var errInvalidStructuredData = errors.New("invalid structured data")
+
+// SyslogParser parses RFC 5424 and RFC 3164 syslog lines. The priority is
+// optional, so lines as written to files by syslogd, such as
+// "Sep 30 00:22:40 host syslogd[124]: message", are understood as well.
+type SyslogParser struct {
+	name string
+}
+
+func NewSyslogParser(name string) *SyslogParser {
+	return &SyslogParser{name: name}
+}
+
+func (p *SyslogParser) Name() string {
+	return p.name
+}
+
+func (p *SyslogParser) Parse(line string) (types.LogEntry, error) {
+	entry := types.LogEntry{Type: types.LogEntryType(p.name)}
+	rest := strings.TrimLeft(line, " \t")
+
+	hasPriority := false
+	if strings.HasPrefix(rest, "<") {
+		if end := strings.IndexByte(rest, '>'); end > 1 {
+			if priority, err := strconv.Atoi(rest[1:end]); err == nil && priority >= 0 && priority < len(facilities)*8 {
+				entry.Facility = facilities[priority/8]
+				entry.Severity = severities[priority%8]
+				rest = rest[end+1:]
+				hasPriority = true
+			}
+		}
+	}
+
+	if hasPriority && strings.HasPrefix(rest, "1 ") {
+		entry, err := parseRFC5424(entry, rest[2:])
+		return withLevel(entry), err
+	}
+	entry, err := parseRFC3164(entry, rest)
+	return withLevel(entry), err
+}
+
+// withLevel sets the level from the severity, or from the message for lines
+// without a priority.
+func withLevel(entry types.LogEntry) types.LogEntry {
+	if entry.Severity != "" {
+		entry.Level, _ = NormalizeLevel(entry.Severity)
+	} else {
+		entry.Level = levelFromMessage(entry.Message)
+	}
+	return entry
+}
+
+// parseRFC5424 parses the header after "<PRI>1 ":
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+func parseRFC5424(entry types.LogEntry, rest string) (types.LogEntry, error) {
+	var fields [5]string
+	for i := range fields {
+		fields[i], rest = nextField(rest)
+		if fields[i] == "" {
+			return types.LogEntry{}, ErrNoTimestamp
+		}
+	}
+	if fields[0] == nilValue {
+		return types.LogEntry{}, ErrNoTimestamp
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return types.LogEntry{}, ErrNoTimestamp
+	}
+	entry.Timestamp = timestamp
+	entry.Hostname = nilToEmpty(fields[1])
+	entry.AppName = nilToEmpty(fields[2])
+	entry.ProcID = nilToEmpty(fields[3])
+	entry.MsgID = nilToEmpty(fields[4])
+
+	rest = strings.TrimLeft(rest, " ")
+	if strings.HasPrefix(rest, nilValue) {
+		rest = rest[len(nilValue):]
+	} else {
+		data, after, err := parseStructuredData(rest)
+		if err != nil {
+			return types.LogEntry{}, err
+		}
+		entry.StructuredData = data
+		rest = after
+	}
+	rest = strings.TrimPrefix(rest, " ")
+	entry.Message = strings.TrimPrefix(rest, "\ufeff")
+	return entry, nil
+}
+
+// parseStructuredData parses elements like [id key="value"][id2 ...] and
+// returns the text following them.
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	data := map[string]map[string]string{}
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		id, rest := nextToken(s, " ]")
+		if id == "" {
+			return nil, "", errInvalidStructuredData
+		}
+		params := map[string]string{}
+		s = rest
+		for {
+			s = strings.TrimLeft(s, " ")
+			if strings.HasPrefix(s, "]") {
+				s = s[1:]
+				break
+			}
+			name, rest := nextToken(s, "=")
+			if name == "" || !strings.HasPrefix(rest, `="`) {
+				return nil, "", errInvalidStructuredData
+			}
+			value, rest, ok := parseParamValue(rest[2:])
+			if !ok {
+				return nil, "", errInvalidStructuredData
+			}
+			params[name] = value
+			s = rest
+		}
+		data[id] = params
+	}
+	return data, s, nil
+}
+
+// parseParamValue reads a quoted value up to its closing quote, undoing the
+// escapes for '"', '\' and ']'.
+func parseParamValue(s string) (string, string, bool) {
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+				i++
+			}
+			value.WriteByte(s[i])
+		case '"':
+			return value.String(), s[i+1:], true
+		default:
+			value.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
+
+// parseRFC3164 parses "TIMESTAMP HOSTNAME TAG[PID]: MSG". The timestamp
+// is either the traditional "Jan _2 15:04:05" or RFC 3339. Without a
+// recognisable hostname and tag everything after the timestamp is the
+// message.
+func parseRFC3164(entry types.LogEntry, rest string) (types.LogEntry, error) {
+	first, after := nextField(rest)
+	if timestamp, err := time.Parse(time.RFC3339Nano, first); err == nil {
+		entry.Timestamp = timestamp
+		rest = after
+	} else {
+		var parts [3]string
+		for i := range parts {
+			parts[i], rest = nextField(rest)
+		}
+		timestamp, err := time.Parse("Jan 2 15:04:05", strings.Join(parts[:], " "))
+		if err != nil {
+			return types.LogEntry{}, ErrNoTimestamp
+		}
+		entry.Timestamp = timestamp
+	}
+
+	host, afterHost := nextField(rest)
+	tag, afterTag := nextField(afterHost)
+	if isHostname(host) && isTag(tag) {
+		entry.Hostname = host
+		entry.AppName, entry.ProcID = splitTag(tag)
+		rest = afterTag
+	}
+	entry.Message = strings.TrimLeft(rest, " ")
+	return entry, nil
+}
+
+var (
+	// hostnamePattern matches lower case names and names with a dot, a
+	// hyphen or a digit, which tells host names apart from the capitalised
+	// first word of a message.
+	hostnamePattern = regexp.MustCompile(`^([a-z0-9][a-z0-9.-]*|[A-Za-z0-9][A-Za-z0-9-]*[0-9.-][A-Za-z0-9.-]*)$`)
+	tagPattern      = regexp.MustCompile(`^[A-Za-z0-9_./-]+(\[[0-9]+\])?:$`)
+)
+
+// isHostname reports whether field looks like a host name or address.
+func isHostname(field string) bool {
+	return hostnamePattern.MatchString(field)
+}
+
+// isTag reports whether field looks like "app:" or "app[pid]:".
+func isTag(field string) bool {
+	return tagPattern.MatchString(field)
+}
+
+func splitTag(tag string) (string, string) {
+	tag = strings.TrimSuffix(tag, ":")
+	if open := strings.IndexByte(tag, '['); open > 0 && strings.HasSuffix(tag, "]") {
+		return tag[:open], tag[open+1 : len(tag)-1]
+	}
+	return tag, ""
+}
+
+// nextField returns the next space separated field of s and what follows it.
+func nextField(s string) (string, string) {
+	s = strings.TrimLeft(s, " ")
+	return nextToken(s, " ")
+}
+
+// nextToken splits s at the first of the stop characters.
+func nextToken(s, stop string) (string, string) {
+	if i := strings.IndexAny(s, stop); i >= 0 {
+		return s[:i], s[i:]
+	}
+	return s, ""
+}
+
+func nilToEmpty(field string) string {
+	if field == nilValue {
+		return ""
+	}
+	return field
+}
@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+func TestSyslogParser_Parse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    types.LogEntry
+		wantErr bool
+	}{
+		{
+			name: "File line without priority",
+			line: "Sep 30 00:22:40 bipen-14QM syslogd[124]: ASL Sender Statistics",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.September, 30, 0, 22, 40, 0, time.UTC),
+				Message:   "ASL Sender Statistics",
+				Type:      "syslog",
+				Hostname:  "bipen-14QM",
+				AppName:   "syslogd",
+				ProcID:    "124",
+			},
+			wantErr: false,
+		},
+		{
+			name: "RFC 3164 with priority and padded day",
+			line: "<34>Oct  1 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 22, 14, 15, 0, time.UTC),
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+				Type:      "syslog",
+				Hostname:  "mymachine",
+				AppName:   "su",
+				Facility:  "auth",
+				Severity:  "crit",
+				Level:     "fatal",
+			},
+			wantErr: false,
+		},
+		{
+			name: "RFC 3164 with an address for hostname",
+			line: "Oct 1 22:14:15 10.0.0.7 com.apple.xpc.launchd[1]: Service exited",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 22, 14, 15, 0, time.UTC),
+				Message:   "Service exited",
+				Type:      "syslog",
+				Hostname:  "10.0.0.7",
+				AppName:   "com.apple.xpc.launchd",
+				ProcID:    "1",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Level keyword in message",
+			line: "Oct 1 22:14:15 host kernel: WARN disk almost full, no error yet",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 22, 14, 15, 0, time.UTC),
+				Message:   "WARN disk almost full, no error yet",
+				Type:      "syslog",
+				Hostname:  "host",
+				AppName:   "kernel",
+				Level:     "warn",
+			},
+			wantErr: false,
+		},
+		{
+			name: "RFC 3164 without hostname",
+			line: "Oct 1 22:14:15 kernel: disk full",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 22, 14, 15, 0, time.UTC),
+				Message:   "kernel: disk full",
+				Type:      "syslog",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Message starting with a word and a colon",
+			line: "Oct 1 13:08:11 Error: disk full",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+				Message:   "Error: disk full",
+				Type:      "syslog",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Message with a colon in its second word",
+			line: "Oct 1 13:08:11 Connection closed: by peer",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+				Message:   "Connection closed: by peer",
+				Type:      "syslog",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Tag with characters a tag cannot have",
+			line: "Oct 1 13:08:11 host user@example.com: logged in",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+				Message:   "host user@example.com: logged in",
+				Type:      "syslog",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Tag with a process ID that is not a number",
+			line: "Oct 1 13:08:11 host app[main]: started",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+				Message:   "host app[main]: started",
+				Type:      "syslog",
+			},
+			wantErr: false,
+		},
+		{
+			name: "RFC 3164 without tag",
+			line: "Oct 1 13:08:11 This is a log entry",
+			want: types.LogEntry{
+				Timestamp: time.Date(0, time.October, 1, 13, 8, 11, 0, time.UTC),
+				Message:   "This is a log entry",
+				Type:      "syslog",
+			},
+			wantErr: false,
+		},
+		{
+			name: "RFC 5424 with structured data",
+			line: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][meta note="a \"quoted\" \] value"] An application event`,
+			want: types.LogEntry{
+				Timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Message:   "An application event",
+				Type:      "syslog",
+				Hostname:  "mymachine.example.com",
+				AppName:   "evntslog",
+				MsgID:     "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+					"meta":              {"note": `a "quoted" ] value`},
+				},
+				Facility: "local4",
+				Severity: "notice",
+				Level:    "info",
+			},
+			wantErr: false,
+		},
+		{
+			name: "RFC 5424 without structured data",
+			line: "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su 77 - - 'su root' failed",
+			want: types.LogEntry{
+				Timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Message:   "'su root' failed",
+				Type:      "syslog",
+				Hostname:  "mymachine.example.com",
+				AppName:   "su",
+				ProcID:    "77",
+				Facility:  "auth",
+				Severity:  "crit",
+				Level:     "fatal",
+			},
+			wantErr: false,
+		},
+		{
+			name:    "RFC 5424 with unterminated structured data",
+			line:    `<34>1 2003-10-11T22:14:15.003Z host app - - [id key="value`,
+			want:    types.LogEntry{},
+			wantErr: true,
+		},
+		{
+			name:    "No timestamp",
+			line:    "WrongTimestamp This is a log entry",
+			want:    types.LogEntry{},
+			wantErr: true,
+		},
+	}
+	parser := NewSyslogParser("syslog")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.Parse(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/bipinshashi/log-collection/internal/config"
+	"github.com/bipinshashi/log-collection/internal/discovery"
+)
+
+const maxRegistrationSize = 4096
+
+// peers returns the peers to query for a request.
+func (a *AppHandler) peers(ctx context.Context) []string {
+	if a.Peers == nil {
+		return discovery.ParseStatic(config.GetConfig().Peers)
+	}
+	peers, err := a.Peers.Peers(ctx)
+	if err != nil {
+		log.Printf("peer discovery: %v", err)
+	}
+	// discovered peers come and go
+	a.Breaker.forget(peers)
+	return peers
+}
+
+// RegisterPeer adds the peer in the request body to the registry, or
+// renews its registration. Peers call it periodically as a heartbeat.
+func (a *AppHandler) RegisterPeer(w http.ResponseWriter, r *http.Request) {
+	// without a token anyone could make this server query any address
+	if a.Registry == nil || a.RegistrationToken == "" {
+		http.Error(w, "peer registration is not enabled", http.StatusNotFound)
+		return
+	}
+	want := []byte("Bearer " + a.RegistrationToken)
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+		http.Error(w, "invalid registration token", http.StatusUnauthorized)
+		return
+	}
+
+	var registration discovery.Registration
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRegistrationSize)).Decode(&registration); err != nil {
+		returnBadRequest("invalid registration", w)
+		return
+	}
+	if _, _, err := net.SplitHostPort(registration.Address); err != nil {
+		returnBadRequest("address should be host:port", w)
+		return
+	}
+	a.Registry.Register(registration.Address)
+	w.WriteHeader(http.StatusNoContent)
+}
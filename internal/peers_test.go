@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/discovery"
+)
+
+func TestAppHandler_RegisterPeer(t *testing.T) {
+	registry := discovery.NewRegistry(time.Minute)
+	a := &AppHandler{Peers: registry, Registry: registry, RegistrationToken: "secret"}
+
+	tests := []struct {
+		name       string
+		body       string
+		token      string
+		wantStatus int
+	}{
+		{name: "Registration", body: `{"address":"api-2:4000"}`, token: "secret", wantStatus: http.StatusNoContent},
+		{name: "Without a token", body: `{"address":"evil:80"}`, wantStatus: http.StatusUnauthorized},
+		{name: "Wrong token", body: `{"address":"evil:80"}`, token: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "Address without port", body: `{"address":"api-2"}`, token: "secret", wantStatus: http.StatusBadRequest},
+		{name: "Invalid body", body: `api-2:4000`, token: "secret", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/api/v1/peers/register", strings.NewReader(tt.body))
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			a.RegisterPeer(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("RegisterPeer() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+
+	if got, want := a.peers(context.Background()), []string{"api-2:4000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("peers() = %v, want %v", got, want)
+	}
+
+	for _, disabled := range []*AppHandler{{}, {Registry: registry}} {
+		w := httptest.NewRecorder()
+		disabled.RegisterPeer(w, httptest.NewRequest("POST", "/api/v1/peers/register", strings.NewReader(`{"address":"api-2:4000"}`)))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("RegisterPeer() without registry or token status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+	}
+}
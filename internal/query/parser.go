@@ -0,0 +1,263 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenRegex
+	tokenField // a word ending in ':' that is followed by its value
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	field string
+	pos   int
+}
+
+func (t token) String() string {
+	return fmt.Sprintf("%q", t.text)
+}
+
+// SyntaxError describes where a query could not be parsed.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid filter at position %d: %s", e.Pos+1, e.Msg)
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, text: ")", pos: i})
+			i++
+		case c == '"' || c == '/':
+			text, next, err := lexQuoted(s, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokenPhrase
+			if c == '/' {
+				kind = tokenRegex
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: i})
+			i = next
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t()\"", rune(s[i])) {
+				i++
+				// a known field name ends the word, its value follows
+				if s[i-1] == ':' {
+					if _, ok := fieldNames[strings.ToLower(s[start:i-1])]; ok {
+						break
+					}
+					if strings.HasPrefix(s[start:i-1], "fields.") && i-1 > start+len("fields.") {
+						break
+					}
+				}
+			}
+			tokens = append(tokens, wordToken(s[start:i], start))
+		}
+	}
+	return tokens, nil
+}
+
+func wordToken(text string, pos int) token {
+	switch text {
+	case "AND":
+		return token{kind: tokenAnd, text: text, pos: pos}
+	case "OR":
+		return token{kind: tokenOr, text: text, pos: pos}
+	case "NOT":
+		return token{kind: tokenNot, text: text, pos: pos}
+	}
+	if name, ok := strings.CutSuffix(text, ":"); ok {
+		if field, ok := fieldNames[strings.ToLower(name)]; ok {
+			return token{kind: tokenField, text: text, field: field, pos: pos}
+		}
+		if strings.HasPrefix(name, "fields.") {
+			return token{kind: tokenField, text: text, field: name, pos: pos}
+		}
+	}
+	return token{kind: tokenWord, text: text, pos: pos}
+}
+
+// lexQuoted reads a phrase or regular expression starting with the quote
+// at s[start]. A backslash escapes the quote; in regular expressions other
+// escapes are kept for the regexp package.
+func lexQuoted(s string, start int) (string, int, error) {
+	quote := s[start]
+	var text strings.Builder
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && (s[i+1] == quote || (quote == '"' && s[i+1] == '\\')):
+			text.WriteByte(s[i+1])
+			i++
+		case s[i] == quote:
+			return text.String(), i + 1, nil
+		default:
+			text.WriteByte(s[i])
+		}
+	}
+	return "", 0, &SyntaxError{Pos: start, Msg: fmt.Sprintf("unterminated %c", quote)}
+}
+
+type queryParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *queryParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *queryParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	pos := 0
+	if !p.done() {
+		pos = p.peek().pos
+	} else if len(p.tokens) > 0 {
+		last := p.tokens[len(p.tokens)-1]
+		pos = last.pos + len(last.text)
+	}
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseOr parses: and (OR and)*
+func (p *queryParser) parseOr() (node, error) {
+	var children orNode
+	for {
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		if p.done() || p.peek().kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return children, nil
+}
+
+// parseAnd parses: not ([AND] not)*
+func (p *queryParser) parseAnd() (node, error) {
+	var children andNode
+	for {
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+		if p.done() {
+			break
+		}
+		if next := p.peek().kind; next == tokenAnd {
+			p.pos++
+		} else if next == tokenOr || next == tokenClose {
+			break
+		}
+	}
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return children, nil
+}
+
+// parseNot parses: NOT not | primary
+func (p *queryParser) parseNot() (node, error) {
+	if !p.done() && p.peek().kind == tokenNot {
+		p.pos++
+		child, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses: ( or ) | field value | word | phrase | regex
+func (p *queryParser) parsePrimary() (node, error) {
+	if p.done() {
+		return nil, p.errorf("expected a term")
+	}
+	tok := p.peek()
+	p.pos++
+	switch tok.kind {
+	case tokenOpen:
+		child, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.done() || p.peek().kind != tokenClose {
+			return nil, p.errorf("expected \")\"")
+		}
+		p.pos++
+		return child, nil
+	case tokenField:
+		if p.done() {
+			return nil, p.errorf("expected a value for %s", tok.text)
+		}
+		value := p.peek()
+		switch value.kind {
+		case tokenWord, tokenPhrase, tokenRegex:
+		default:
+			return nil, p.errorf("expected a value for %s", tok.text)
+		}
+		p.pos++
+		m, err := newMatcher(value)
+		if err != nil {
+			return nil, err
+		}
+		return fieldNode{field: tok.field, matcher: m}, nil
+	case tokenWord, tokenPhrase, tokenRegex:
+		m, err := newMatcher(tok)
+		if err != nil {
+			return nil, err
+		}
+		return textNode{matcher: m}, nil
+	default:
+		p.pos--
+		return nil, p.errorf("unexpected %s", tok)
+	}
+}
+
+func newMatcher(tok token) (matcher, error) {
+	if tok.kind == tokenRegex {
+		regex, err := regexp.Compile(tok.text)
+		if err != nil {
+			return matcher{}, &SyntaxError{Pos: tok.pos, Msg: err.Error()}
+		}
+		return matcher{regex: regex}, nil
+	}
+	return matcher{literal: strings.ToLower(tok.text)}, nil
+}
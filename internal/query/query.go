@@ -0,0 +1,181 @@
+// Package query implements the filter language of the logs API.
+//
+// A query is made of terms combined with AND, OR and NOT (upper case) and
+// grouped with parentheses. Terms next to each other must all match. A term
+// is a word, a "quoted phrase", a /regular expression/ or a field predicate
+// such as server:api-2, level:error or process:"my app", whose value may be
+// a word, a phrase or a regular expression. Words and phrases match case
+// insensitively.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// Query is a parsed filter.
+type Query struct {
+	raw  string
+	root node
+}
+
+// Parse parses a filter. It returns an error describing the position of
+// the first syntax error.
+func Parse(s string) (*Query, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected %s", p.peek())
+	}
+	return &Query{raw: s, root: root}, nil
+}
+
+// Match reports whether entry satisfies the query.
+func (q *Query) Match(entry types.LogEntry) bool {
+	return q.root.match(entry)
+}
+
+// String returns the query as it was written.
+func (q *Query) String() string {
+	return q.raw
+}
+
+type node interface {
+	match(entry types.LogEntry) bool
+}
+
+type andNode []node
+
+func (n andNode) match(entry types.LogEntry) bool {
+	for _, child := range n {
+		if !child.match(entry) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []node
+
+func (n orNode) match(entry types.LogEntry) bool {
+	for _, child := range n {
+		if child.match(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct {
+	child node
+}
+
+func (n notNode) match(entry types.LogEntry) bool {
+	return !n.child.match(entry)
+}
+
+// textNode matches a word, phrase or regular expression anywhere in the
+// message, app name or hostname.
+type textNode struct {
+	matcher matcher
+}
+
+func (n textNode) match(entry types.LogEntry) bool {
+	for _, value := range []string{entry.Message, entry.AppName, entry.Hostname} {
+		if n.matcher.contains(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldNode matches the value of a single field.
+type fieldNode struct {
+	field   string
+	matcher matcher
+}
+
+func (n fieldNode) match(entry types.LogEntry) bool {
+	if n.field == "message" {
+		return n.matcher.contains(entry.Message)
+	}
+	value, ok := fieldValue(entry, n.field)
+	return ok && n.matcher.equals(value)
+}
+
+// fieldNames maps the names usable in predicates to entry fields.
+var fieldNames = map[string]string{
+	"server":   "server",
+	"type":     "type",
+	"level":    "level",
+	"severity": "severity",
+	"facility": "facility",
+	"host":     "hostname",
+	"hostname": "hostname",
+	"app":      "app",
+	"process":  "app",
+	"pid":      "pid",
+	"msgid":    "msgid",
+	"message":  "message",
+}
+
+func fieldValue(entry types.LogEntry, field string) (string, bool) {
+	switch field {
+	case "server":
+		return entry.Server, true
+	case "type":
+		return string(entry.Type), true
+	case "level":
+		return entry.Level, true
+	case "severity":
+		return entry.Severity, true
+	case "facility":
+		return entry.Facility, true
+	case "hostname":
+		return entry.Hostname, true
+	case "app":
+		return entry.AppName, true
+	case "pid":
+		return entry.ProcID, true
+	case "msgid":
+		return entry.MsgID, true
+	}
+	if key, ok := strings.CutPrefix(field, "fields."); ok {
+		value, ok := entry.Fields[key]
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
+
+// matcher is either a case insensitive literal or a regular expression.
+type matcher struct {
+	literal string
+	regex   *regexp.Regexp
+}
+
+func (m matcher) contains(value string) bool {
+	if m.regex != nil {
+		return m.regex.MatchString(value)
+	}
+	return strings.Contains(strings.ToLower(value), m.literal)
+}
+
+func (m matcher) equals(value string) bool {
+	if m.regex != nil {
+		return m.regex.MatchString(value)
+	}
+	return strings.ToLower(value) == m.literal
+}
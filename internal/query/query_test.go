@@ -0,0 +1,92 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+func TestQuery_Match(t *testing.T) {
+	entry := types.LogEntry{
+		Server:   "api-2",
+		Message:  "Request timed out after 30s",
+		Type:     types.System,
+		Hostname: "bipen-14QM",
+		AppName:  "syslogd",
+		ProcID:   "124",
+		Severity: "err",
+		Level:    "error",
+		Fields:   map[string]any{"order_id": 42, "region": "eu-west"},
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  bool
+	}{
+		{name: "Word is case insensitive", query: "TIMED", want: true},
+		{name: "Word in app name", query: "syslogd", want: true},
+		{name: "Missing word", query: "error", want: false},
+		{name: "Implicit AND", query: "request 30s", want: true},
+		{name: "Implicit AND with missing word", query: "request error", want: false},
+		{name: "Explicit AND", query: "request AND timed", want: true},
+		{name: "OR", query: "error OR timed", want: true},
+		{name: "NOT", query: "NOT error", want: true},
+		{name: "Lower case keywords are words", query: "request and", want: false},
+		{name: "Phrase", query: `"timed out"`, want: true},
+		{name: "Phrase out of order", query: `"out timed"`, want: false},
+		{name: "Regex", query: `/time[sd] out after \d+s/`, want: true},
+		{name: "Regex is case sensitive", query: `/request/`, want: false},
+		{name: "Regex with escaped slash", query: `/a\/b/ OR timed`, want: true},
+		{name: "Parentheses", query: "(error OR timed) AND NOT server:api-3", want: true},
+		{name: "Parentheses change precedence", query: "error OR timed AND server:api-3", want: false},
+		{name: "Server predicate", query: "server:api-2", want: true},
+		{name: "Server predicate is exact", query: "server:api", want: false},
+		{name: "Process predicate", query: "process:syslogd pid:124 host:BIPEN-14QM", want: true},
+		{name: "Level predicate", query: "level:error", want: true},
+		{name: "Severity predicate", query: "severity:err", want: true},
+		{name: "Predicate with phrase", query: `message:"timed out"`, want: true},
+		{name: "Predicate with regex", query: `server:/^api-\d$/`, want: true},
+		{name: "JSON field predicate", query: "fields.order_id:42 fields.region:eu-west", want: true},
+		{name: "Missing JSON field", query: "fields.customer:42", want: false},
+		{name: "Unknown field is a word", query: "after:", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := q.Match(entry); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "Unclosed parenthesis", query: "(error OR timed", want: `invalid filter at position 16: expected ")"`},
+		{name: "Unexpected close", query: "error)", want: `invalid filter at position 6: unexpected ")"`},
+		{name: "Dangling OR", query: "error OR", want: "invalid filter at position 9: expected a term"},
+		{name: "Unterminated phrase", query: `"timed out`, want: `invalid filter at position 1: unterminated "`},
+		{name: "Unterminated regex", query: `/timed`, want: "invalid filter at position 1: unterminated /"},
+		{name: "Invalid regex", query: `/timed(/`, want: "invalid filter at position 1: error parsing regexp: missing closing ): `timed(`"},
+		{name: "Predicate without value", query: "server:", want: "invalid filter at position 8: expected a value for server:"},
+		{name: "Operator as value", query: "server: OR", want: "invalid filter at position 9: expected a value for server:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			if err == nil {
+				t.Fatalf("Parse() error = nil, want %q", tt.want)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Parse() error = %q, want %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
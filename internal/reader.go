@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+const defaultBlockSize = 64 * 1024
+
+// reverseLineReader reads lines from the end of a file towards the start,
+// one block at a time, so the tail of a large file can be read without
+// scanning it from the beginning. Lines longer than maxLine are cut short
+// to their first maxLine bytes.
+type reverseLineReader struct {
+	r         io.ReadSeeker
+	blockSize int64
+	maxLine   int
+	pos       int64  // file offset of the first byte in buf
+	buf       []byte // bytes read from the file but not yet returned as lines
+	store     []byte // holds buf, with room before it for the blocks to come
+	head      int    // index of buf in store
+	started   bool
+	offset    int64 // file offset of the line returned last
+}
+
+func newReverseLineReader(r io.ReadSeeker, blockSize int) *reverseLineReader {
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+	return &reverseLineReader{r: r, blockSize: int64(blockSize), maxLine: maxLineSize}
+}
+
+// Line returns the previous line of the file without its trailing newline.
+// It returns io.EOF once the start of the file has been reached. The line
+// is only valid until the next call.
+func (rr *reverseLineReader) Line() ([]byte, error) {
+	if !rr.started {
+		size, err := rr.r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		rr.pos = size
+		rr.started = true
+		// a trailing newline terminates the last line, it does not start a new one
+		if err := rr.fill(); err != nil {
+			return nil, err
+		}
+		rr.buf = bytes.TrimSuffix(rr.buf, []byte("\n"))
+	}
+
+	for {
+		if i := bytes.LastIndexByte(rr.buf, '\n'); i >= 0 {
+			line := rr.buf[i+1:]
+			rr.buf = rr.buf[:i]
+			rr.offset = rr.pos + int64(i) + 1
+			return rr.cut(line), nil
+		}
+		if rr.pos == 0 {
+			if rr.buf == nil {
+				return nil, io.EOF
+			}
+			line := rr.buf
+			rr.buf = nil
+			rr.offset = 0
+			return rr.cut(line), nil
+		}
+		if err := rr.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// cut drops the line's carriage return and anything past maxLine.
+func (rr *reverseLineReader) cut(line []byte) []byte {
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return line[:min(len(line), rr.maxLine)]
+}
+
+// readLine returns the next line of r without its line ending, cut short
+// to its first maxLine bytes like reverseLineReader does, and how many
+// bytes of r it took up. It returns io.EOF once r is exhausted.
+func readLine(r *bufio.Reader, maxLine int) ([]byte, int, error) {
+	var line []byte
+	n := 0
+	for {
+		chunk, err := r.ReadSlice('\n')
+		n += len(chunk)
+		// keep room for the line ending, which is trimmed below
+		if keep := maxLine + 2 - len(line); keep > 0 {
+			line = append(line, chunk[:min(len(chunk), keep)]...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && n > 0 {
+			break
+		}
+		if err != nil {
+			return nil, n, err
+		}
+		break
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	return line[:min(len(line), maxLine)], n, nil
+}
+
+// Offset returns the file offset at which the line returned last starts.
+func (rr *reverseLineReader) Offset() int64 {
+	return rr.offset
+}
+
+// fill prepends the previous block of the file to buf. buf holds the end
+// of a line at this point, which is cut off once it is longer than
+// maxLine. Blocks are read into the room in front of buf, and store grows
+// geometrically when there is none, so long lines are not copied again
+// for every block.
+func (rr *reverseLineReader) fill() error {
+	if rr.pos == 0 {
+		return nil
+	}
+	n := int(min(rr.blockSize, rr.pos))
+	rr.pos -= int64(n)
+	if _, err := rr.r.Seek(rr.pos, io.SeekStart); err != nil {
+		return err
+	}
+	if len(rr.buf) > rr.maxLine {
+		rr.buf = rr.buf[:rr.maxLine]
+	}
+	if rr.head < n {
+		need := len(rr.buf) + n
+		if need > len(rr.store) {
+			rr.store = make([]byte, max(2*len(rr.store), need))
+		}
+		// move buf to the end of store, leaving the room in front
+		head := len(rr.store) - len(rr.buf)
+		copy(rr.store[head:], rr.buf)
+		rr.head = head
+	}
+	if _, err := io.ReadFull(rr.r, rr.store[rr.head-n:rr.head]); err != nil {
+		return err
+	}
+	rr.head -= n
+	rr.buf = rr.store[rr.head : rr.head+n+len(rr.buf)]
+	return nil
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_reverseLineReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		blockSize int
+		maxLine   int
+		want      []string
+		offsets   []int64
+	}{
+		{
+			name:      "Empty file",
+			data:      "",
+			blockSize: 4,
+			want:      nil,
+		},
+		{
+			name:      "Trailing newline",
+			data:      "one\ntwo\nthree\n",
+			blockSize: 4,
+			want:      []string{"three", "two", "one"},
+			offsets:   []int64{8, 4, 0},
+		},
+		{
+			name:      "No trailing newline",
+			data:      "one\ntwo\nthree",
+			blockSize: 4,
+			want:      []string{"three", "two", "one"},
+		},
+		{
+			name:      "Lines longer than block size",
+			data:      "a long first line\r\na longer second line\r\n",
+			blockSize: 3,
+			want:      []string{"a longer second line", "a long first line"},
+			offsets:   []int64{19, 0},
+		},
+		{
+			name:      "Line longer than the limit",
+			data:      "short\n0123456789abcdef\nend\n",
+			blockSize: 4,
+			maxLine:   8,
+			want:      []string{"end", "01234567", "short"},
+			offsets:   []int64{23, 6, 0},
+		},
+		{
+			name:      "Line longer than the limit at the start",
+			data:      "0123456789abcdef\nend",
+			blockSize: 5,
+			maxLine:   10,
+			want:      []string{"end", "0123456789"},
+			offsets:   []int64{17, 0},
+		},
+		{
+			name:      "Blank lines",
+			data:      "one\n\ntwo\n",
+			blockSize: 64,
+			want:      []string{"two", "", "one"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newReverseLineReader(bytes.NewReader([]byte(tt.data)), tt.blockSize)
+			if tt.maxLine > 0 {
+				reader.maxLine = tt.maxLine
+			}
+			var got []string
+			var offsets []int64
+			for {
+				line, err := reader.Line()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Line() error = %v", err)
+				}
+				got = append(got, string(line))
+				offsets = append(offsets, reader.Offset())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Line() = %q, want %q", got, tt.want)
+			}
+			if tt.offsets != nil && !reflect.DeepEqual(offsets, tt.offsets) {
+				t.Errorf("Offset() = %v, want %v", offsets, tt.offsets)
+			}
+		})
+	}
+}
+
+func Test_readLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		size    int
+		maxLine int
+		want    []string
+		lengths []int
+	}{
+		{
+			name:    "Line endings",
+			data:    "one\r\ntwo\nthree",
+			size:    16,
+			maxLine: 8,
+			want:    []string{"one", "two", "three"},
+			lengths: []int{5, 4, 5},
+		},
+		{
+			name:    "Line longer than the buffer",
+			data:    "0123456789abcdefghij\nend\n",
+			size:    16,
+			maxLine: 32,
+			want:    []string{"0123456789abcdefghij", "end"},
+			lengths: []int{21, 4},
+		},
+		{
+			name:    "Line longer than the limit",
+			data:    "0123456789abcdefghij\r\nend\n",
+			size:    16,
+			maxLine: 8,
+			want:    []string{"01234567", "end"},
+			lengths: []int{22, 4},
+		},
+		{
+			name:    "Blank lines",
+			data:    "\n\n",
+			size:    16,
+			maxLine: 8,
+			want:    []string{"", ""},
+			lengths: []int{1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReaderSize(strings.NewReader(tt.data), tt.size)
+			var got []string
+			var lengths []int
+			for {
+				line, n, err := readLine(reader, tt.maxLine)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("readLine() error = %v", err)
+				}
+				got = append(got, string(line))
+				lengths = append(lengths, n)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readLine() = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(lengths, tt.lengths) {
+				t.Errorf("readLine() lengths = %v, want %v", lengths, tt.lengths)
+			}
+		})
+	}
+}
+
+func Test_readAllLines_longLine(t *testing.T) {
+	long := strings.Repeat("x", 2*maxLineSize)
+	data := "Oct 1 13:08:07 first\nOct 1 13:08:08 " + long + "\nOct 1 13:08:09 last\n"
+	params := RequestParams{fileName: "system.log", lines: 3}
+	got, err := readAllLines(strings.NewReader(data), params, testSource)
+	if err != nil {
+		t.Fatalf("readAllLines() error = %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("readAllLines() returned %d entries, want 3", len(got))
+	}
+	if want := long[:maxLineSize-len("Oct 1 13:08:08 ")]; got[1].Message != want {
+		t.Errorf("readAllLines() kept %d bytes of the long line, want %d", len(got[1].Message), len(want))
+	}
+	if got[0].Message != "last" {
+		t.Errorf("readAllLines() newest = %q, want %q", got[0].Message, "last")
+	}
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/bipinshashi/log-collection/internal/parser"
+	"github.com/bipinshashi/log-collection/internal/types"
+	"github.com/bipinshashi/log-collection/internal/utils"
+	"github.com/klauspost/compress/zstd"
+)
+
+// readLastNLinesRotated reads the last n entries of a log file and, when the
+// file does not hold enough of them, continues into its rotated
+// generations newest first. With a cursor it continues from the position
+// the cursor holds for this server instead of the end of the file.
+func readLastNLinesRotated(filePath string, params RequestParams, source logSource) ([]types.LogEntry, error) {
+	generations, err := utils.RotatedFiles(filePath)
+	if err != nil {
+		return nil, err
+	}
+	files := append([]string{filePath}, generations...)
+
+	start, limit := 0, int64(-1)
+	if position, ok := params.cursor.position(source.server, source.instance); ok {
+		start, limit, params = resumeFrom(files, position, params)
+	} else if params.cursor != nil {
+		params.until = earliest(params.until, params.cursor.Until)
+	}
+
+	var logs []types.LogEntry
+	for i := start; i < len(files); i++ {
+		if i > 0 && !params.since.IsZero() {
+			// a generation last written before since holds nothing newer
+			if info, err := os.Stat(files[i]); err == nil && info.ModTime().Before(params.since) {
+				break
+			}
+		}
+		remaining := params
+		remaining.lines = params.lines - len(logs)
+		older, err := readGeneration(files[i], remaining, source, limit)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, older...)
+		if len(logs) >= params.lines || params.budget.spent() {
+			break
+		}
+		limit = -1
+	}
+	return logs, nil
+}
+
+// readGeneration reads the last n entries of a single log file, looking
+// only at its first limit bytes unless limit is negative.
+// Compressed generations cannot be read backwards and are scanned in full.
+func readGeneration(path string, params RequestParams, source logSource, limit int64) ([]types.LogEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileID, err := fileIdentity(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	source = source.withModTime(info.ModTime()).withFile(filepath.Base(path), fileID)
+
+	if isCompressed(path) {
+		reader, err := decompress(path, file)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		if limit >= 0 {
+			return readAllLines(io.LimitReader(reader, limit), params, source)
+		}
+		return readAllLines(reader, params, source)
+	}
+	if limit < 0 {
+		limit = info.Size()
+	}
+	if !params.until.IsZero() {
+		// everything past the first indexed entry after until is newer
+		if offset, ok := params.index.seek(path, file, info, parser.ForFile(params.fileName), source, params.until); ok && offset < limit {
+			limit = offset
+		}
+	}
+	if !params.since.IsZero() {
+		params.orderedUpTo = params.index.ordered(path, file, info, parser.ForFile(params.fileName), source)
+	}
+	// reading a section also keeps lines appended while reading out
+	return readLastNLines(io.NewSectionReader(file, 0, limit), params, source)
+}
+
+func isCompressed(path string) bool {
+	return utils.TrimCompressedExtension(path) != path
+}
+
+// decompress wraps file in a reader for the compression its name implies.
+func decompress(path string, file io.Reader) (io.ReadCloser, error) {
+	switch filepath.Ext(path) {
+	case ".gz":
+		return gzip.NewReader(bufio.NewReader(file))
+	case ".bz2":
+		return io.NopCloser(bzip2.NewReader(bufio.NewReader(file))), nil
+	case ".zst":
+		decoder, err := zstd.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return io.NopCloser(file), nil
+	}
+}
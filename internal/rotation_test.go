@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func Test_readLastNLinesRotated(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var gz bytes.Buffer
+	gzWriter := gzip.NewWriter(&gz)
+	gzWriter.Write([]byte("Oct 1 13:08:03 gzip entry\nOct 1 13:08:04 gzip entry\n"))
+	gzWriter.Close()
+
+	var zst bytes.Buffer
+	zstWriter, err := zstd.NewWriter(&zst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zstWriter.Write([]byte("Oct 1 13:08:01 zstd entry\nOct 1 13:08:02 zstd entry\n"))
+	zstWriter.Close()
+
+	write("system.log", []byte("Oct 1 13:08:07 current entry\nOct 1 13:08:08 current entry\n"))
+	write("system.log.0", []byte("Oct 1 13:08:05 plain entry\nOct 1 13:08:06 plain entry\n"))
+	write("system.log.1.gz", gz.Bytes())
+	write("system.log.2.zst", zst.Bytes())
+
+	tests := []struct {
+		name   string
+		params RequestParams
+		want   []string
+	}{
+		{
+			name:   "Current file holds enough entries",
+			params: RequestParams{fileName: "system.log", lines: 2},
+			want:   []string{"current entry", "current entry"},
+		},
+		{
+			name:   "Continues into plain and gzip generations",
+			params: RequestParams{fileName: "system.log", lines: 5},
+			want: []string{
+				"current entry",
+				"current entry",
+				"plain entry",
+				"plain entry",
+				"gzip entry",
+			},
+		},
+		{
+			name:   "Filter reaches the zstd generation",
+			params: RequestParams{fileName: "system.log", lines: 10, filter: "zstd", query: mustParseQuery("zstd")},
+			want:   []string{"zstd entry", "zstd entry"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, err := readLastNLinesRotated(filepath.Join(dir, "system.log"), tt.params, logSource{server: "api", location: time.UTC})
+			if err != nil {
+				t.Fatalf("readLastNLinesRotated() error = %v", err)
+			}
+			var got []string
+			for _, entry := range logs {
+				got = append(got, entry.Message)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readLastNLinesRotated() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
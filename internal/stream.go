@@ -0,0 +1,528 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/config"
+	"github.com/bipinshashi/log-collection/internal/parser"
+	"github.com/bipinshashi/log-collection/internal/types"
+	"github.com/bipinshashi/log-collection/internal/utils"
+)
+
+const (
+	followPollInterval = 500 * time.Millisecond
+	heartbeatInterval  = 15 * time.Second
+	mergeWindow        = time.Second
+	peerStreamBuffer   = 256
+	peerReconnectMin   = time.Second
+	peerReconnectMax   = 30 * time.Second
+	// continuationWait is how long the last entry of a followed file is
+	// held back for continuation lines once no more lines arrive
+	continuationWait = followPollInterval
+	// maxFollowRead is how much of a followed file one poll reads at most,
+	// the rest is left for the next
+	maxFollowRead = 4 * 1024 * 1024
+)
+
+// StreamLogs sends the last n entries of a file and then keeps the
+// connection open, pushing new entries as Server-Sent Events as they are
+// appended to the file.
+func (a *AppHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
+	params, err := validateQueryParams(r.URL.Query())
+	if err != nil {
+		returnBadRequest(err.Error(), w)
+		return
+	}
+	params.trace, err = requestTrace(r, instanceID)
+	if err != nil {
+		refuseLoop(w, err)
+		return
+	}
+
+	filePath, err := utils.ValidateFilePath(logDir, params.fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			returnBadRequest("File does not exist", w)
+		} else if os.IsPermission(err) {
+			returnBadRequest("Permission denied", w)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	follower, err := newFileFollower(filePath)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer follower.Close()
+	if maxBytes := config.GetConfig().QueryMaxBytes; maxBytes > 0 {
+		follower.maxRead = min(follower.maxRead, maxBytes)
+	}
+
+	source, err := newLogSource(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	info, err := follower.file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	backlog := io.NewSectionReader(follower.file, 0, follower.offset)
+	params.budget = newQueryBudget(config.GetConfig(), time.Now())
+	if err := a.Scans.acquire(r.Context()); err != nil {
+		http.Error(w, errScanQueueFull.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	logs, err := readLastNLines(backlog, params, source.withModTime(info.ModTime()))
+	a.Scans.release()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	events := newSSEWriter(w)
+	if err := events.start(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// the backlog stopped at a limit, say so before it is sent
+	if reason := params.budget.truncated(); reason != "" {
+		if err := events.comment("truncated: " + reason); err != nil {
+			return
+		}
+	}
+
+	// entries from peers arrive independently, hold them for a short
+	// window so the merged stream comes out roughly in timestamp order
+	ctx := r.Context()
+	peerEntries := make(chan types.LogEntry, peerStreamBuffer)
+	var peers []string
+	if len(params.trace) <= config.GetConfig().MaxFanOutDepth {
+		peers = a.peers(ctx)
+	}
+	var merge *reorderBuffer
+	if len(peers) > 0 {
+		merge = newReorderBuffer(mergeWindow)
+		for _, peer := range peers {
+			go a.followPeer(ctx, peer, params, peerEntries)
+		}
+	} else {
+		merge = newReorderBuffer(0)
+	}
+
+	// send the backlog oldest first, like tail -f
+	now := time.Now()
+	for i := len(logs) - 1; i >= 0; i-- {
+		merge.add(logs[i], now)
+	}
+
+	grouper := newFollowGrouper(parser.ForFile(params.fileName), source)
+	poll := time.NewTicker(followPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		for _, entry := range merge.flush(time.Now()) {
+			if err := events.send(entry); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if err := events.comment("keep-alive"); err != nil {
+				return
+			}
+		case entry := <-peerEntries:
+			merge.add(entry, time.Now())
+		case <-poll.C:
+			lines, err := follower.poll()
+			if err != nil {
+				log.Println(err)
+				return
+			}
+			now := time.Now()
+			for _, entry := range grouper.add(lines, now) {
+				if matchesFilter(entry, params) {
+					merge.add(entry, now)
+				}
+			}
+		}
+	}
+}
+
+// followPeer subscribes to the stream endpoint of a peer and forwards its
+// entries until ctx is done, reconnecting with a backoff when the
+// connection drops. Entries a reconnect replays from the backlog are
+// skipped: those older than the newest entry forwarded, and as many of
+// those with its time as were forwarded.
+func (a *AppHandler) followPeer(ctx context.Context, peer string, params RequestParams, entries chan<- types.LogEntry) {
+	// a client timeout would cut the stream short
+	client := *a.Client
+	client.Timeout = 0
+
+	var lastSeen time.Time
+	// entries forwarded with the time lastSeen. Replayed entries have a
+	// position where live ones have none, so they are told apart by
+	// message.
+	atLastSeen := map[streamKey]int{}
+	backoff := peerReconnectMin
+	for {
+		skipUntil, skip := lastSeen, maps.Clone(atLastSeen)
+		connected, err := readPeerStream(ctx, &client, getStreamUrlForPeer(peer, params), params.trace, func(entry types.LogEntry) {
+			key := streamKey{server: entry.Server, message: entry.Message}
+			if !skipUntil.IsZero() {
+				if entry.Timestamp.Before(skipUntil) {
+					return
+				}
+				if entry.Timestamp.Equal(skipUntil) && skip[key] > 0 {
+					skip[key]--
+					return
+				}
+			}
+			switch {
+			case entry.Timestamp.After(lastSeen):
+				lastSeen = entry.Timestamp
+				atLastSeen = map[streamKey]int{key: 1}
+			case entry.Timestamp.Equal(lastSeen):
+				atLastSeen[key]++
+			}
+			select {
+			case entries <- entry:
+			case <-ctx.Done():
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errRequestLoop) {
+			log.Printf("not following peer %s: %v", peer, err)
+			return
+		}
+		if connected {
+			backoff = peerReconnectMin
+		}
+		log.Printf("stream from peer %s dropped: %v, reconnecting in %s", peer, err, backoff)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > peerReconnectMax {
+			backoff = peerReconnectMax
+		}
+	}
+}
+
+// streamKey tells apart entries of a peer's stream with the same time.
+type streamKey struct {
+	server  string
+	message string
+}
+
+// readPeerStream reads Server-Sent Events from url and calls emit for each
+// entry. It reports whether the connection was established.
+func readPeerStream(ctx context.Context, client *http.Client, url string, trace []string, emit func(types.LogEntry)) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	setTrace(req, trace)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusLoopDetected {
+		return false, loopError(resp, trace, "")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, maxLineSize)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var entry types.LogEntry
+			decoder := json.NewDecoder(strings.NewReader(strings.Join(data, "\n")))
+			decoder.UseNumber()
+			if err := decoder.Decode(&entry); err != nil {
+				return true, err
+			}
+			data = data[:0]
+			emit(entry)
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, io.EOF
+}
+
+// reorderBuffer holds entries for a window after they are received and
+// releases them in timestamp order.
+type reorderBuffer struct {
+	window  time.Duration
+	pending []bufferedEntry
+}
+
+type bufferedEntry struct {
+	entry    types.LogEntry
+	received time.Time
+}
+
+func newReorderBuffer(window time.Duration) *reorderBuffer {
+	return &reorderBuffer{window: window}
+}
+
+func (b *reorderBuffer) add(entry types.LogEntry, received time.Time) {
+	b.pending = append(b.pending, bufferedEntry{entry: entry, received: received})
+}
+
+// flush returns the entries that have been held for at least the window,
+// oldest first.
+func (b *reorderBuffer) flush(now time.Time) []types.LogEntry {
+	if len(b.pending) == 0 {
+		return nil
+	}
+	sort.SliceStable(b.pending, func(i, j int) bool {
+		return b.pending[i].entry.Timestamp.Before(b.pending[j].entry.Timestamp)
+	})
+	cutoff := now.Add(-b.window)
+	var ready []types.LogEntry
+	kept := b.pending[:0]
+	for _, pending := range b.pending {
+		if pending.received.After(cutoff) {
+			kept = append(kept, pending)
+		} else {
+			ready = append(ready, pending.entry)
+		}
+	}
+	b.pending = kept
+	return ready
+}
+
+// sseWriter writes log entries to a response as Server-Sent Events.
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	return &sseWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+func (s *sseWriter) start() error {
+	// streams outlive the server's WriteTimeout
+	if err := s.rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.Header().Set("Connection", "keep-alive")
+	s.w.WriteHeader(http.StatusOK)
+	return s.rc.Flush()
+}
+
+func (s *sseWriter) send(entry types.LogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *sseWriter) comment(msg string) error {
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", msg); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// followGrouper groups the lines of a followed file into records. Its last
+// entry is held back across polls, as its continuation lines may not have
+// been written yet, until a new entry starts or no lines arrive for
+// continuationWait.
+type followGrouper struct {
+	grouper  *lineGrouper
+	source   logSource
+	lastLine time.Time
+	holding  bool
+}
+
+func newFollowGrouper(p parser.Parser, source logSource) *followGrouper {
+	return &followGrouper{grouper: newLineGrouper(p, source), source: source}
+}
+
+// add consumes the lines of a poll at now and returns the records that are
+// complete.
+func (g *followGrouper) add(lines []string, now time.Time) []types.LogEntry {
+	// new lines were just written, so the year is the current one
+	g.grouper.source = g.source.withModTime(now)
+	var records []types.LogEntry
+	for _, line := range lines {
+		// the source has no file, so offsets are not tracked
+		records = append(records, g.grouper.add(line, 0)...)
+	}
+	if len(lines) > 0 {
+		g.lastLine, g.holding = now, true
+	} else if g.holding && now.Sub(g.lastLine) >= continuationWait {
+		records = append(records, g.grouper.flush()...)
+		g.holding = false
+	}
+	return records
+}
+
+// fileFollower returns lines appended to a file since it was last polled.
+// It reopens the file when it is replaced and starts over from the
+// beginning when it is truncated. A poll reads at most maxRead bytes, and
+// lines are cut short to their first maxLine bytes.
+type fileFollower struct {
+	path    string
+	file    *os.File
+	offset  int64
+	maxRead int64
+	maxLine int
+	partial []byte
+	// overlong is set while the rest of a line cut short is skipped
+	overlong bool
+}
+
+func newFileFollower(path string) (*fileFollower, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &fileFollower{path: path, file: file, offset: offset, maxRead: maxFollowRead, maxLine: maxLineSize}, nil
+}
+
+func (f *fileFollower) Close() error {
+	return f.file.Close()
+}
+
+// poll returns the complete lines written since the previous call, up to
+// maxRead bytes of them.
+func (f *fileFollower) poll() ([]string, error) {
+	lines, n, err := f.readNew()
+	if err != nil {
+		return nil, err
+	}
+	if n == f.maxRead {
+		// the file is not read to its end yet
+		return lines, nil
+	}
+
+	current, err := f.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := os.Stat(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// rotated away and not recreated yet
+			return lines, nil
+		}
+		return nil, err
+	}
+
+	switch {
+	case !os.SameFile(current, latest):
+		file, err := os.Open(f.path)
+		if err != nil {
+			return nil, err
+		}
+		f.file.Close()
+		f.file, f.offset, f.partial, f.overlong = file, 0, nil, false
+	case latest.Size() < f.offset:
+		f.offset, f.partial, f.overlong = 0, nil, false
+	default:
+		return lines, nil
+	}
+
+	more, _, err := f.readNew()
+	if err != nil {
+		return nil, err
+	}
+	return append(lines, more...), nil
+}
+
+// readNew reads from the current offset towards the end of the open file,
+// at most maxRead bytes, and returns the complete lines and how many bytes
+// it read.
+func (f *fileFollower) readNew() ([]string, int64, error) {
+	if _, err := f.file.Seek(f.offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	data, err := io.ReadAll(io.LimitReader(f.file, f.maxRead))
+	if err != nil {
+		return nil, 0, err
+	}
+	n := int64(len(data))
+	f.offset += n
+
+	if f.overlong {
+		// the end of the line cut short is still to come
+		skip := bytes.IndexByte(data, '\n')
+		if skip < 0 {
+			return nil, n, nil
+		}
+		data, f.overlong = data[skip:], false
+	}
+	data = append(f.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	partial := data[end+1:]
+	if len(partial) > f.maxLine {
+		partial, f.overlong = partial[:f.maxLine], true
+	}
+	f.partial = append([]byte(nil), partial...)
+	if end < 0 {
+		return nil, n, nil
+	}
+
+	var lines []string
+	for _, line := range bytes.Split(data[:end], []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		lines = append(lines, string(line[:min(len(line), f.maxLine)]))
+	}
+	return lines, n, nil
+}
@@ -0,0 +1,320 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/parser"
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+func Test_fileFollower(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "system.log")
+	if err := os.WriteFile(path, []byte("Oct 1 13:08:07 existing entry\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	follower, err := newFileFollower(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Close()
+
+	appendTo := func(data string) {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.WriteString(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{
+			name:   "No new data",
+			change: func() {},
+			want:   nil,
+		},
+		{
+			name:   "Appended lines",
+			change: func() { appendTo("Oct 1 13:08:08 first\nOct 1 13:08:09 sec") },
+			want:   []string{"Oct 1 13:08:08 first"},
+		},
+		{
+			name:   "Partial line completed",
+			change: func() { appendTo("ond\n") },
+			want:   []string{"Oct 1 13:08:09 second"},
+		},
+		{
+			name: "File truncated",
+			change: func() {
+				if err := os.Truncate(path, 0); err != nil {
+					t.Fatal(err)
+				}
+				appendTo("Oct 1 13:08:10 after truncate\n")
+			},
+			want: []string{"Oct 1 13:08:10 after truncate"},
+		},
+		{
+			name: "File replaced",
+			change: func() {
+				appendTo("Oct 1 13:08:11 before rotate\n")
+				if err := os.Rename(path, path+".1"); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("Oct 1 13:08:12 after rotate\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			want: []string{"Oct 1 13:08:11 before rotate", "Oct 1 13:08:12 after rotate"},
+		},
+		{
+			name: "Read limited",
+			change: func() {
+				follower.maxRead = 32
+				appendTo("Oct 1 13:08:13 one\nOct 1 13:08:14 two\n")
+			},
+			want: []string{"Oct 1 13:08:13 one"},
+		},
+		{
+			name:   "Rest read on the next poll",
+			change: func() {},
+			want:   []string{"Oct 1 13:08:14 two"},
+		},
+		{
+			name: "Line longer than the limit",
+			change: func() {
+				follower.maxRead, follower.maxLine = maxFollowRead, 10
+				appendTo("0123456789abcdef")
+			},
+			want: nil,
+		},
+		{
+			name:   "Line longer than the limit completed",
+			change: func() { appendTo("ghij\r\nnext\n") },
+			want:   []string{"0123456789", "next"},
+		},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			step.change()
+			got, err := follower.poll()
+			if err != nil {
+				t.Fatalf("poll() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, step.want) {
+				t.Errorf("poll() = %q, want %q", got, step.want)
+			}
+		})
+	}
+}
+
+func Test_StreamLogs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "system.log")
+	if err := os.WriteFile(path, []byte("Oct 1 13:08:07 backlog entry\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(dir string) { logDir = dir }(logDir)
+	logDir = dir + "/"
+
+	a := &AppHandler{}
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		a.StreamLogs(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"?file=system.log&n=5", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	messages := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var entry types.LogEntry
+			if err := json.Unmarshal([]byte(data), &entry); err != nil {
+				t.Errorf("event %q: %v", data, err)
+				continue
+			}
+			messages <- entry.Message
+		}
+		close(messages)
+	}()
+	receive := func() string {
+		select {
+		case message := <-messages:
+			return message
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event within 5s")
+			return ""
+		}
+	}
+
+	if got := receive(); got != "backlog entry" {
+		t.Errorf("first event = %q, want %q", got, "backlog entry")
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("Oct 1 13:08:08 live entry\n")
+	file.Close()
+	if got := receive(); got != "live entry" {
+		t.Errorf("second event = %q, want %q", got, "live entry")
+	}
+
+	// the handler returns once the client goes away
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StreamLogs() did not return after the client disconnected")
+	}
+}
+
+func Test_reorderBuffer(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 13, 8, 0, 0, time.UTC)
+	entry := func(second int, server string) types.LogEntry {
+		return types.LogEntry{Timestamp: start.Add(time.Duration(second) * time.Second), Server: server}
+	}
+
+	buffer := newReorderBuffer(time.Second)
+	buffer.add(entry(3, "api"), start)
+	buffer.add(entry(1, "api-2"), start.Add(500*time.Millisecond))
+	buffer.add(entry(2, "api-3"), start.Add(1500*time.Millisecond))
+
+	if got := buffer.flush(start.Add(900 * time.Millisecond)); got != nil {
+		t.Errorf("flush() before window = %v, want nothing", got)
+	}
+	want := []types.LogEntry{entry(1, "api-2"), entry(3, "api")}
+	if got := buffer.flush(start.Add(1500 * time.Millisecond)); !reflect.DeepEqual(got, want) {
+		t.Errorf("flush() = %v, want %v", got, want)
+	}
+	want = []types.LogEntry{entry(2, "api-3")}
+	if got := buffer.flush(start.Add(3 * time.Second)); !reflect.DeepEqual(got, want) {
+		t.Errorf("flush() = %v, want %v", got, want)
+	}
+}
+
+func Test_readPeerStream(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"timestamp\":\"2024-10-01T13:08:07Z\",\"server\":\"api-2\",\"message\":\"first\",\"type\":\"system\"}\n\n")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "data: {\"timestamp\":\"2024-10-01T13:08:08Z\",\"server\":\"api-2\",\"message\":\"second\",\"type\":\"system\"}\n\n")
+	}))
+	defer peer.Close()
+
+	var got []string
+	connected, err := readPeerStream(context.Background(), peer.Client(), peer.URL, nil, func(entry types.LogEntry) {
+		got = append(got, entry.Server+" "+entry.Message)
+	})
+	if !connected {
+		t.Fatalf("readPeerStream() connected = false, error = %v", err)
+	}
+	want := []string{"api-2 first", "api-2 second"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readPeerStream() entries = %q, want %q", got, want)
+	}
+}
+
+func Test_followPeer_reconnect(t *testing.T) {
+	event := func(second int, message string) string {
+		return fmt.Sprintf("data: {\"timestamp\":\"2024-10-01T13:08:%02dZ\",\"server\":\"api-2\",\"message\":%q,\"type\":\"system\"}\n\n", second, message)
+	}
+	var connections atomic.Int32
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, event(7, "older"), event(8, "first at 8"))
+		if connections.Add(1) == 1 {
+			// drop the connection
+			return
+		}
+		fmt.Fprint(w, event(8, "second at 8"), event(9, "newer"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer peer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a := &AppHandler{Client: peer.Client()}
+	entries := make(chan types.LogEntry)
+	go a.followPeer(ctx, strings.TrimPrefix(peer.URL, "http://"), RequestParams{}, entries)
+
+	var got []string
+	for len(got) < 4 {
+		select {
+		case entry := <-entries:
+			got = append(got, entry.Message)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("followPeer() forwarded %q, want 4 entries", got)
+		}
+	}
+	want := []string{"older", "first at 8", "second at 8", "newer"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("followPeer() forwarded %q, want %q", got, want)
+	}
+}
+
+func Test_followGrouper(t *testing.T) {
+	start := time.Date(2024, time.October, 1, 13, 8, 7, 0, time.UTC)
+	grouper := newFollowGrouper(parser.ForFile("system.log"), testSource)
+	polls := []struct {
+		lines []string
+		after time.Duration
+		want  []string
+	}{
+		{lines: []string{"Oct 1 13:08:07 request failed"}},
+		// the stack trace arrives in the next poll
+		{lines: []string{"  at main.handle(main.go:10)"}, after: followPollInterval},
+		{after: followPollInterval + continuationWait/2},
+		{after: followPollInterval + continuationWait, want: []string{"request failed\n  at main.handle(main.go:10)"}},
+		{lines: []string{"Oct 1 13:08:08 first", "Oct 1 13:08:09 second"}, after: 3 * followPollInterval, want: []string{"first"}},
+		{after: 3*followPollInterval + continuationWait, want: []string{"second"}},
+		{after: 4*followPollInterval + continuationWait},
+	}
+	for i, poll := range polls {
+		var got []string
+		for _, entry := range grouper.add(poll.lines, start.Add(poll.after)) {
+			got = append(got, entry.Message)
+		}
+		if !reflect.DeepEqual(got, poll.want) {
+			t.Errorf("poll %d: add() = %q, want %q", i, got, poll.want)
+		}
+	}
+}
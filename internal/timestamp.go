@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/bipinshashi/log-collection/internal/types"
+)
+
+// rolloverSlack is how far past the reference time an entry may be before
+// it is taken to belong to the previous year.
+const rolloverSlack = 24 * time.Hour
+
+// logSource describes where entries are read from: the server they belong
+// to, the time zone they were written in and a reference time, usually the
+// file's modification time, used to infer the year timestamps leave out.
+// file is the base name of the file, empty when positions are not tracked,
+// and fileID its identity, see fileIdentity. instance tells apart servers
+// sharing a name.
+type logSource struct {
+	server   string
+	instance string
+	location *time.Location
+	modTime  time.Time
+	file     string
+	fileID   string
+}
+
+// resolve turns a timestamp parsed without year or zone, such as
+// "Jan 2 15:04:05", into an absolute instant. The year is the one of the
+// reference time, or the one before when that would put the entry in the
+// future, which happens for December entries in a file written in January.
+// Feb 29 goes back to the last leap year.
+func (s logSource) resolve(t time.Time) time.Time {
+	if t.IsZero() || t.Year() != 0 {
+		return t
+	}
+	location := s.location
+	if location == nil {
+		location = time.UTC
+	}
+	ref := s.modTime
+	if ref.IsZero() {
+		ref = now()
+	}
+	ref = ref.In(location)
+
+	year := ref.Year()
+	in := func(year int) time.Time {
+		return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location)
+	}
+	resolved := in(year)
+	if resolved.After(ref.Add(rolloverSlack)) {
+		year--
+		resolved = in(year)
+	}
+	// Feb 29 of a year without one rolls over to Mar 1
+	for resolved.Day() != t.Day() {
+		year--
+		resolved = in(year)
+	}
+	return resolved
+}
+
+// withFile returns a copy of the source for entries read from file.
+func (s logSource) withFile(file, fileID string) logSource {
+	s.file, s.fileID = file, fileID
+	return s
+}
+
+// position returns the position of the line at offset, or nil when the
+// source does not track positions.
+func (s logSource) position(offset int64) *types.Position {
+	if s.file == "" {
+		return nil
+	}
+	return &types.Position{File: s.file, Offset: offset, FileID: s.fileID, Instance: s.instance}
+}
+
+// withModTime returns a copy of the source using modTime as reference.
+func (s logSource) withModTime(modTime time.Time) logSource {
+	s.modTime = modTime
+	return s
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// traceHeader lists the servers a request for logs has passed through,
+	// the one the client asked first, so requests can fan out through a
+	// tree of servers without going round in circles.
+	traceHeader = "X-Log-Trace"
+	// instanceHeader names the server that refused a request as a loop.
+	instanceHeader = "X-Log-Instance"
+)
+
+// instanceID tells this server apart in traces. Server names are
+// configured and often left at their default, so it is picked at random
+// when the process starts.
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+// errRequestLoop is returned for requests that have already passed through
+// a server, which is answered with 508 Loop Detected.
+var errRequestLoop = errors.New("request loop")
+
+// requestTrace returns the servers r has passed through including self, or
+// errRequestLoop if it has been here before.
+func requestTrace(r *http.Request, self string) ([]string, error) {
+	var trace []string
+	for _, server := range strings.Split(r.Header.Get(traceHeader), ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			trace = append(trace, server)
+		}
+	}
+	trace = append(trace, self)
+	for _, server := range trace[:len(trace)-1] {
+		if server == self {
+			return nil, fmt.Errorf("%w through %s", errRequestLoop, strings.Join(trace, " -> "))
+		}
+	}
+	return trace, nil
+}
+
+// refuseLoop answers a request that has been here before with 508 Loop
+// Detected.
+func refuseLoop(w http.ResponseWriter, err error) {
+	w.Header().Set(instanceHeader, instanceID)
+	http.Error(w, err.Error(), http.StatusLoopDetected)
+}
+
+// loopError is the error for a peer that refused a request as a loop. Only
+// a peer the request came through is a loop, as it returns its own entries;
+// any other peer's entries are missing, which is reported as an error.
+func loopError(resp *http.Response, trace []string, message string) error {
+	if message != "" {
+		message = ": " + message
+	}
+	instance := resp.Header.Get(instanceHeader)
+	for _, server := range trace {
+		if instance != "" && server == instance {
+			return fmt.Errorf("%w%s", errRequestLoop, message)
+		}
+	}
+	return fmt.Errorf("%s outside this request's trace%s", resp.Status, message)
+}
+
+// setTrace passes the trace on to a peer.
+func setTrace(req *http.Request, trace []string) {
+	if len(trace) > 0 {
+		req.Header.Set(traceHeader, strings.Join(trace, ","))
+	}
+}
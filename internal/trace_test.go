@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_requestTrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    []string
+		wantErr bool
+	}{
+		{name: "Asked by a client", header: "", want: []string{"api"}},
+		{name: "Asked by a peer", header: "edge, agg", want: []string{"edge", "agg", "api"}},
+		{name: "Been here before", header: "api,agg", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/v1/logs", nil)
+			if tt.header != "" {
+				r.Header.Set(traceHeader, tt.header)
+			}
+			got, err := requestTrace(r, "api")
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, errRequestLoop)) {
+				t.Fatalf("requestTrace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("requestTrace() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_fanOut_loop(t *testing.T) {
+	var header, instance string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(traceHeader)
+		if _, err := requestTrace(r, "api-2"); err != nil {
+			w.Header().Set(instanceHeader, instance)
+			http.Error(w, err.Error(), http.StatusLoopDetected)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer peer.Close()
+	host := strings.TrimPrefix(peer.URL, "http://")
+
+	a := &AppHandler{Client: peer.Client(), Breaker: NewCircuitBreaker(1, time.Minute)}
+	options := peerOptions{workers: 1, timeout: time.Second, retries: 2}
+
+	options.trace = []string{"api"}
+	_, err := drain(a.fanOut(context.Background(), []string{host}, RequestParams{lines: 10}, options)[0])
+	if err != nil || header != "api" {
+		t.Errorf("fanOut() error = %v, trace sent = %q, want nil, %q", err, header, "api")
+	}
+
+	options.trace = []string{"api-2", "api"}
+	instance = "api-2"
+	stream := a.fanOut(context.Background(), []string{host}, RequestParams{lines: 10}, options)[0]
+	drain(stream)
+	attempts, _, err := stream.result()
+	if !errors.Is(err, errRequestLoop) || attempts != 1 {
+		t.Errorf("fanOut() = %v after %d attempts, want a loop after 1", err, attempts)
+	}
+	if !a.Breaker.allow(host, time.Now()) {
+		t.Error("a loop tripped the circuit breaker")
+	}
+
+	// a peer answering for a server the request did not come through
+	instance = "api-3"
+	stream = a.fanOut(context.Background(), []string{host}, RequestParams{lines: 10}, options)[0]
+	drain(stream)
+	if _, _, err := stream.result(); err == nil || errors.Is(err, errRequestLoop) {
+		t.Errorf("fanOut() = %v, want an error other than a loop", err)
+	}
+}
+
+func Test_instanceID(t *testing.T) {
+	if instanceID == "" || instanceID == newInstanceID() {
+		t.Errorf("instanceID = %q, want a random ID", instanceID)
+	}
+}
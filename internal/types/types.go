@@ -11,6 +11,50 @@ const (
 
 type GlobalLogState struct {
 	Entries []LogEntry
+	Servers []ServerStatus
+}
+
+// Server statuses
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+	// StatusCircuitOpen is reported for peers that were not asked because
+	// they failed repeatedly.
+	StatusCircuitOpen = "circuit_open"
+	// StatusPending is reported for peers that did not answer within the
+	// time the client was willing to wait.
+	StatusPending = "pending"
+	// StatusLoop is reported for peers that refused a request that already
+	// passed through them.
+	StatusLoop = "loop"
+)
+
+// ServerStatus reports how a server answered a request for logs.
+type ServerStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	// EntryCount is how many entries the server returned, which may be
+	// more than made it into the merged page
+	EntryCount int `json:"entry_count"`
+	Attempts   int `json:"attempts,omitempty"`
+	// Truncated names the limit that stopped the server reading before it
+	// found all entries, e.g. "max_bytes"
+	Truncated string `json:"truncated,omitempty"`
+}
+
+// LogsResponse is the body returned by /api/v2/logs. Truncated is set when
+// entries are missing because a server could not be read or stopped at one
+// of its limits, Warnings says why.
+type LogsResponse struct {
+	Entries    []LogEntry     `json:"entries"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Servers    []ServerStatus `json:"servers"`
+	Truncated  bool           `json:"truncated"`
+	// TruncatedReason names the limit that stopped a server reading, if any
+	TruncatedReason string   `json:"truncated_reason,omitempty"`
+	Warnings        []string `json:"warnings,omitempty"`
 }
 
 type LogEntry struct {
@@ -18,6 +62,50 @@ type LogEntry struct {
 	Server    string       `json:"server"`
 	Message   string       `json:"message"`
 	Type      LogEntryType `json:"type"`
+
+	// syslog header fields, empty when the format has no such field
+	Hostname       string                       `json:"hostname,omitempty"`
+	AppName        string                       `json:"app_name,omitempty"`
+	ProcID         string                       `json:"proc_id,omitempty"`
+	MsgID          string                       `json:"msg_id,omitempty"`
+	StructuredData map[string]map[string]string `json:"structured_data,omitempty"`
+	Facility       string                       `json:"facility,omitempty"`
+	Severity       string                       `json:"severity,omitempty"`
+
+	// Level is the severity normalised to trace, debug, info, warn, error
+	// or fatal, empty when it is not known
+	Level string `json:"level,omitempty"`
+
+	// Fields holds the keys of structured (JSON) lines that have no field
+	// of their own
+	Fields map[string]any `json:"fields,omitempty"`
+
+	// ParseError marks lines the parser could not read. Message holds the
+	// raw line and Timestamp is that of the entry before it, if any.
+	ParseError bool `json:"parse_error,omitempty"`
+
+	// Position is where the entry starts in the file it was read from
+	Position *Position `json:"position,omitempty"`
+
+	// Before and After hold the entries around a match when context is
+	// requested, in file order. Context entries never have context of
+	// their own.
+	Before []LogEntry `json:"before,omitempty"`
+	After  []LogEntry `json:"after,omitempty"`
+}
+
+// Position locates a line in a log file. File is the base name of the
+// file, which may be a rotated generation, and Offset the byte offset of
+// the line in its uncompressed content.
+type Position struct {
+	File   string `json:"file"`
+	Offset int64  `json:"offset"`
+	// FileID identifies the file by its first bytes, so it is found again
+	// after rotation renamed it.
+	FileID string `json:"file_id,omitempty"`
+	// Instance identifies the server process that read the line, as
+	// servers may share a name.
+	Instance string `json:"instance,omitempty"`
 }
 
 const (
@@ -3,6 +3,9 @@ package utils
 import (
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -21,3 +24,74 @@ func ValidateFilePath(dir, filename string) (string, error) {
 
 	return filePath, nil
 }
+
+// compressedExtensions are the suffixes rotated log generations may be
+// compressed with.
+var compressedExtensions = []string{".gz", ".bz2", ".zst"}
+
+var dateSuffix = regexp.MustCompile(`^\d{4}-?\d{2}-?\d{2}`)
+
+// RotatedFiles returns the paths of the rotated generations of filePath,
+// such as system.log.0.gz, system.log.1 or system.log-20240101, newest
+// first. Numbered generations come before dated ones.
+func RotatedFiles(filePath string) ([]string, error) {
+	dir, base := filepath.Split(filePath)
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type generation struct {
+		path   string
+		number int
+		date   string
+	}
+	var generations []generation
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || len(name) <= len(base)+1 || !strings.HasPrefix(name, base) {
+			continue
+		}
+		sep, suffix := name[len(base)], TrimCompressedExtension(name[len(base)+1:])
+		if sep != '.' && sep != '-' && sep != '_' {
+			continue
+		}
+		gen := generation{path: filepath.Join(dir, name), number: -1}
+		if number, err := strconv.Atoi(suffix); err == nil && sep == '.' {
+			gen.number = number
+		} else if dateSuffix.MatchString(suffix) {
+			gen.date = suffix
+		} else {
+			continue
+		}
+		generations = append(generations, gen)
+	}
+
+	sort.Slice(generations, func(i, j int) bool {
+		a, b := generations[i], generations[j]
+		if (a.number >= 0) != (b.number >= 0) {
+			return a.number >= 0
+		}
+		if a.number >= 0 {
+			return a.number < b.number
+		}
+		return a.date > b.date
+	})
+
+	paths := make([]string, len(generations))
+	for i, gen := range generations {
+		paths[i] = gen.path
+	}
+	return paths, nil
+}
+
+// TrimCompressedExtension removes a compression suffix such as .gz from
+// name.
+func TrimCompressedExtension(name string) string {
+	for _, ext := range compressedExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -56,3 +59,43 @@ func TestValidateFilePath(t *testing.T) {
 		})
 	}
 }
+
+func TestRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"system.log",
+		"system.log.1",
+		"system.log.0.gz",
+		"system.log.10.bz2",
+		"system.log.2.zst",
+		"system.log-20240101",
+		"system.log-20240102.gz",
+		"system.log.bak",
+		"system.logger",
+		"wifi.log.0.gz",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := RotatedFiles(filepath.Join(dir, "system.log"))
+	if err != nil {
+		t.Fatalf("RotatedFiles() error = %v", err)
+	}
+	var names []string
+	for _, path := range got {
+		names = append(names, filepath.Base(path))
+	}
+	want := []string{
+		"system.log.0.gz",
+		"system.log.1",
+		"system.log.2.zst",
+		"system.log.10.bz2",
+		"system.log-20240102.gz",
+		"system.log-20240101",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("RotatedFiles() = %v, want %v", names, want)
+	}
+}
@@ -7,35 +7,83 @@ import (
 	"os"
 	"os/signal"
 	"time"
+	// time zones for TIMEZONE and FILE_TIMEZONES, the production image has no tzdata
+	_ "time/tzdata"
 
 	handler "github.com/bipinshashi/log-collection/internal"
 	"github.com/bipinshashi/log-collection/internal/config"
+	"github.com/bipinshashi/log-collection/internal/discovery"
+	"github.com/bipinshashi/log-collection/internal/parser"
 	"github.com/gorilla/mux"
 )
 
 func main() {
 
-	client := &http.Client{
-		Timeout: time.Second * 10,
+	config := config.GetConfig()
+
+	// timeouts are set per peer request, see PEER_TIMEOUT
+	client := &http.Client{}
+	if _, err := config.PeerTimeoutOverrides(); err != nil {
+		log.Fatal(err)
+	}
+
+	peers := discovery.Multi{discovery.ParseStatic(config.Peers)}
+	// registered addresses are queried and their entries returned, so only
+	// peers holding the token may register
+	var registry *discovery.Registry
+	if config.PeerRegistration {
+		if config.RegistrationToken == "" {
+			log.Fatal("PEER_REGISTRATION_TOKEN is needed to accept peer registrations")
+		}
+		registry = discovery.NewRegistry(config.RegistrationTTL)
+		peers = append(peers, registry)
+	}
+	if config.PeersFile != "" {
+		peers = append(peers, discovery.NewFile(config.PeersFile))
+	}
+	if config.PeersDNS != "" {
+		peers = append(peers, discovery.NewDNS(config.PeersDNS, nil, config.PeersDNSRefresh))
 	}
 
 	appHandler := &handler.AppHandler{
-		Client: client,
+		Client:            client,
+		Breaker:           handler.NewCircuitBreaker(config.BreakerThreshold, config.BreakerCooldown),
+		Scans:             handler.NewScanLimiter(config.MaxConcurrentScans),
+		Index:             handler.NewIndexStore(config.IndexDir),
+		Peers:             peers,
+		Registry:          registry,
+		RegistrationToken: config.RegistrationToken,
+	}
+
+	jsonKeys := parser.DefaultJSONKeys
+	if len(config.JSONTimestampKeys) > 0 {
+		jsonKeys.Timestamp = config.JSONTimestampKeys
+	}
+	if len(config.JSONLevelKeys) > 0 {
+		jsonKeys.Level = config.JSONLevelKeys
+	}
+	if len(config.JSONMessageKeys) > 0 {
+		jsonKeys.Message = config.JSONMessageKeys
+	}
+	parser.Register(parser.NewJSONParser("json", jsonKeys))
+	if err := parser.AddRules(config.ParserRules); err != nil {
+		log.Fatal(err)
 	}
 
 	r := mux.NewRouter()
 	r.HandleFunc("/api/v1/logs", appHandler.GetLogs).Methods("GET")
+	r.HandleFunc("/api/v1/logs/stream", appHandler.StreamLogs).Methods("GET")
+	r.HandleFunc("/api/v2/logs", appHandler.GetLogsV2).Methods("GET")
+	r.HandleFunc("/api/v1/peers/register", appHandler.RegisterPeer).Methods("POST")
 	r.HandleFunc("/", appHandler.ShowDemo).Methods("GET")
 
-	config := config.GetConfig()
-
 	srv := &http.Server{
 		Addr: "0.0.0.0:" + config.Port,
 		// Good practice to set timeouts to avoid Slowloris attacks.
 		WriteTimeout: time.Second * 15,
 		ReadTimeout:  time.Second * 15,
 		IdleTimeout:  time.Second * 60,
-		Handler:      r,
+		Handler:      handler.CompressResponses(r, config.CompressMinSize),
 	}
 
 	// Run our server in a goroutine so that it doesn't block.
@@ -46,6 +94,15 @@ func main() {
 	}()
 	log.Printf("Server started on port %s", config.Port)
 
+	// join another server as its peer, renewing before the registration
+	// expires
+	if config.RegisterWith != "" {
+		if config.AdvertiseAddr == "" {
+			log.Fatal("ADVERTISE_ADDR is needed to register with another server")
+		}
+		go discovery.Heartbeat(context.Background(), client, config.RegisterWith, config.AdvertiseAddr, config.RegistrationToken, config.RegistrationTTL/3)
+	}
+
 	var wait time.Duration
 
 	c := make(chan os.Signal, 1)